@@ -1,36 +1,91 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"github.com/xunil154/gobar/ui"
+	"io"
 	"log"
 	"os"
+	"strings"
 )
 
 var (
-	uiSegments = make([]ui.PromptSegment, 0, 10)
-	logger     = log.New(os.Stdout, "logger: ", log.Ltime)
+	uiSegments  = make([]ui.PromptSegment, 0, 10)
+	logger      = log.New(os.Stdout, "logger: ", log.Ltime)
+	configPath  = flag.String("config", "gobar.ini", "Configuration file")
+	commandFlag = flag.String("c", "", "Run commands separated by ; then exit")
+	exitOnError = flag.Bool("e", false,
+		"Exit on the first command that fails, when not interactive")
 )
 
 func defaultPrompt() ui.PromptSegment {
-	return ui.NewPromptSegment("gobar", "black", "white")
+	return ui.NewStyledSegment("gobar", "prompt")
 }
 
 func registerCommands() {
 }
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v [options] [script]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *commandFlag != "" && flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "gobar: -c can't be used with a script\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := ui.DetectTerminal(); err != nil {
+		fmt.Fprintf(os.Stderr, "gobar: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Never leave the terminal without echo, even on panic
+	defer ui.RestoreTerminal()
+
 	// Shared with commands
-	uiSegments = append(uiSegments, defaultPrompt())
+	uiSegments = append(uiSegments, ui.VPNSegment(), ui.StatusSegment(),
+		defaultPrompt())
 
 	ui.BootstrapCommands()
+	interactive := *commandFlag == "" && flag.NArg() == 0 && ui.IsInteractive()
+	if err := ui.LoadConfig(*configPath); err != nil && interactive {
+		ui.Error(fmt.Sprintf("%v", err), uiSegments)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "gobar: %v\n", err)
+	}
+
+	if !interactive {
+		os.Exit(runScript())
+	}
+
 	for {
 		input := ui.GetUserInput(uiSegments, ui.TabComplete)
 		if input == "exit" || input == "quit" {
 			break
 		}
-		fmt.Println("")
-		output, err := ui.ProcessInput(input)
+		if !ui.IsPlainTerminal() {
+			ui.EndLine()
+		}
+		if !runLines(input) {
+			break
+		}
+	}
+
+	ui.Exit()
+}
+
+// Run each command of the input, pasted input can hold several lines and a
+// line several commands. Returns false when one of them asks to exit.
+func runLines(input string) bool {
+	for _, command := range ui.SplitCommands(input) {
+		if command == "exit" || command == "quit" {
+			return false
+		}
+		output, err := ui.ProcessInput(command)
 
 		if err != nil {
 			ui.Error(fmt.Sprintf("%v", err), uiSegments)
@@ -38,8 +93,66 @@ func main() {
 			ui.Output(output.Output, uiSegments)
 		}
 	}
+	return true
+}
 
-	ui.Exit()
+// Run commands without a prompt: those given with -c, or else the lines of
+// the script named on the command line or of stdin. Returns the exit status,
+// that of the last command, or of the first to fail with -e.
+func runScript() int {
+	var input io.Reader = os.Stdin
+	name := "stdin"
+	if *commandFlag != "" {
+		input = strings.NewReader(*commandFlag)
+		name = "-c"
+	} else if flag.NArg() > 0 {
+		name = flag.Arg(0)
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gobar: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	} else {
+		// The rest of the script is on stdin, programs it runs must not
+		// read it
+		devNull, err := os.Open(os.DevNull)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gobar: %v\n", err)
+			return 1
+		}
+		defer devNull.Close()
+		ui.SetCommandInput(devNull)
+	}
+
+	status := 0
+	scanner := bufio.NewScanner(input)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		for _, command := range ui.SplitCommands(scanner.Text()) {
+			if command == "exit" || command == "quit" {
+				return status
+			}
+			output, err := ui.ProcessInput(command)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "gobar: %v:%v: %v\n", name, lineno, err)
+				status = 1
+				if *exitOnError {
+					return status
+				}
+				continue
+			}
+			status = 0
+			if len(output.Output) > 0 {
+				fmt.Println(output.Output)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "gobar: %v: %v\n", name, err)
+		return 1
+	}
+	return status
 }
 
 ////// COMMANDS \\\\\\\
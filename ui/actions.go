@@ -0,0 +1,261 @@
+package ui
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	Editing actions for the line editor, named after their readline
+	equivalents. Killed text goes to the console's kill ring, shared by all its
+	lines, so it can be yanked back on a later prompt.
+*/
+
+const (
+	killRingSize = 10
+)
+
+func acceptLine(line *commandLine) {
+	line.done = true
+}
+
+// Discard the line and start a new one, like a shell does. Pressed again
+// straight after on an empty line it exits.
+func cancelLine(line *commandLine) {
+	if line.length() == 0 && line.lastAction == "cancel-line" {
+		line.eof = true
+		line.done = true
+		return
+	}
+	line.cancelled = true
+}
+
+func backwardDeleteChar(line *commandLine) {
+	if line.cursor > 0 {
+		line.input = deleteChar(line.input, line.cursor-1)
+		line.cursor -= 1 // Move cursor back one
+	}
+}
+
+func deleteCharAction(line *commandLine) {
+	if line.cursor < line.length() {
+		line.input = deleteChar(line.input, line.cursor)
+	}
+}
+
+// Like a shell, Ctrl + d on an empty line means end of input
+func deleteCharOrEOF(line *commandLine) {
+	if line.length() == 0 {
+		line.eof = true
+		line.done = true
+		return
+	}
+	deleteCharAction(line)
+}
+
+func backwardChar(line *commandLine) {
+	if line.cursor > 0 {
+		line.cursor -= 1
+	}
+}
+
+// At the end of the line, accepts the suggestion
+func forwardChar(line *commandLine) {
+	if line.cursor < line.length() {
+		line.cursor += 1
+	} else if line.suggestion != "" {
+		line.acceptSuggestion(-1)
+	}
+}
+
+func beginningOfLine(line *commandLine) {
+	line.cursor = 0
+}
+
+// At the end of the line, accepts the suggestion
+func endOfLine(line *commandLine) {
+	if line.cursor == line.length() && line.suggestion != "" {
+		line.acceptSuggestion(-1)
+	}
+	line.cursor = line.length()
+}
+
+func backwardWord(line *commandLine) {
+	line.cursor = wordStart([]rune(line.input), line.cursor)
+}
+
+// At the end of the line, accepts a word of the suggestion
+func forwardWord(line *commandLine) {
+	if line.cursor == line.length() && line.suggestion != "" {
+		line.acceptSuggestion(line.suggestedWord())
+	}
+	line.cursor = wordEnd([]rune(line.input), line.cursor)
+}
+
+func previousHistory(line *commandLine) {
+	prev := line.editor().history.previous()
+	if prev != "" {
+		line.input = prev
+	}
+	line.cursor = line.length()
+}
+
+func nextHistory(line *commandLine) {
+	next := line.editor().history.next()
+	line.input = next
+	line.cursor = line.length()
+}
+
+func killLine(line *commandLine) {
+	line.kill(line.cursor, line.length())
+}
+
+func unixLineDiscard(line *commandLine) {
+	line.kill(0, line.cursor)
+}
+
+// Kill back to the previous whitespace
+func unixWordRubout(line *commandLine) {
+	runes := []rune(line.input)
+	start := line.cursor
+	for start > 0 && unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	line.kill(start, line.cursor)
+}
+
+func killWord(line *commandLine) {
+	line.kill(line.cursor, wordEnd([]rune(line.input), line.cursor))
+}
+
+func backwardKillWord(line *commandLine) {
+	line.kill(wordStart([]rune(line.input), line.cursor), line.cursor)
+}
+
+// Insert the most recently killed text
+func yank(line *commandLine) {
+	killRing := line.editor().killRing
+	if len(killRing) == 0 {
+		return
+	}
+	line.yankIndex = len(killRing) - 1
+	line.insertYank(killRing[line.yankIndex])
+}
+
+// Replace the text just yanked with the next older kill
+func yankPop(line *commandLine) {
+	killRing := line.editor().killRing
+	if len(killRing) == 0 || (line.lastAction != "yank" && line.lastAction != "yank-pop") {
+		return
+	}
+	runes := []rune(line.input)
+	start := line.cursor - line.yankLength
+	line.input = string(runes[:start]) + string(runes[line.cursor:])
+	line.cursor = start
+
+	line.yankIndex -= 1
+	if line.yankIndex < 0 {
+		line.yankIndex = len(killRing) - 1
+	}
+	line.insertYank(killRing[line.yankIndex])
+}
+
+// Swap the character before the cursor with the one under it. At the end of
+// the line the last two characters are swapped.
+func transposeChars(line *commandLine) {
+	runes := []rune(line.input)
+	if line.cursor == 0 || len(runes) < 2 {
+		return
+	}
+	if line.cursor == len(runes) {
+		line.cursor -= 1
+	}
+	runes[line.cursor-1], runes[line.cursor] = runes[line.cursor], runes[line.cursor-1]
+	line.input = string(runes)
+	line.cursor += 1
+}
+
+func clearScreenAction(line *commandLine) {
+	line.clear = true
+}
+
+func reverseSearchHistory(line *commandLine) {
+	line.startSearch()
+}
+
+// Remove the runes between start and end and put them in the kill ring.
+// Consecutive kills are joined into one kill ring entry.
+func (line *commandLine) kill(start int, end int) {
+	if start >= end {
+		return
+	}
+	runes := []rune(line.input)
+	killed := string(runes[start:end])
+	line.input = string(runes[:start]) + string(runes[end:])
+	line.cursor = start
+
+	killRing := line.editor().killRing
+	if isKillAction(line.lastAction) && len(killRing) > 0 {
+		last := len(killRing) - 1
+		if end <= line.killedAt {
+			killRing[last] = killed + killRing[last]
+		} else {
+			killRing[last] += killed
+		}
+	} else {
+		line.editor().pushKill(killed)
+	}
+	line.killedAt = start
+}
+
+func isKillAction(action string) bool {
+	switch action {
+	case "kill-line", "unix-line-discard", "unix-word-rubout", "kill-word",
+		"backward-kill-word":
+		return true
+	}
+	return false
+}
+
+// Add text to the kill ring, dropping the oldest entry when it is full
+func (state *editorState) pushKill(text string) {
+	if len(state.killRing) == cap(state.killRing) {
+		state.killRing = append(state.killRing[:0], state.killRing[1:]...)
+	}
+	state.killRing = append(state.killRing, text)
+}
+
+// Insert text at the cursor, remembering its length for yank-pop
+func (line *commandLine) insertYank(text string) {
+	line.insertText(text)
+	line.yankLength = utf8.RuneCountInString(text)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Index of the start of the word before index
+func wordStart(runes []rune, index int) int {
+	for index > 0 && !isWordRune(runes[index-1]) {
+		index--
+	}
+	for index > 0 && isWordRune(runes[index-1]) {
+		index--
+	}
+	return index
+}
+
+// Index of the end of the word after index
+func wordEnd(runes []rune, index int) int {
+	for index < len(runes) && !isWordRune(runes[index]) {
+		index++
+	}
+	for index < len(runes) && isWordRune(runes[index]) {
+		index++
+	}
+	return index
+}
@@ -0,0 +1,122 @@
+package ui
+
+import (
+	"testing"
+)
+
+func TestLineEditingActions(t *testing.T) {
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys     string
+		expected string
+		cursor   int
+	}{
+		{"hello\x01", "hello", 0},                       // C-a
+		{"hello\x01\x05", "hello", 5},                   // C-e
+		{"hello\x02\x02\x06", "hello", 4},               // C-b C-b C-f
+		{"hello\x01\x04", "ello", 0},                    // C-d deletes
+		{"one two three\x1bb", "one two three", 8},      // M-b
+		{"one two three\x1bb\x1bb", "one two three", 4}, // M-b M-b
+		{"one two three\x01\x1bf", "one two three", 3},  // M-f
+		{"one two three\x1bb\x0b", "one two ", 8},       // C-k
+		{"one two three\x1bb\x15", "three", 0},          // C-u
+		{"one two three\x17", "one two ", 8},            // C-w
+		{"one two three\x17\x17", "one ", 4},            // C-w C-w
+		{"one two three\x01\x1bd", " two three", 0},     // M-d
+		{"one two-three\x1b\x7f", "one two-", 8},        // M-Backspace
+		{"one two\x17\x01\x19", "twoone ", 3},           // C-w C-a C-y
+		{"one two\x17\x17\x19", "one two", 7},           // joined kills
+		{"ab\x14", "ba", 2},                             // C-t at end
+		{"abc\x02\x02\x14", "bac", 2},                   // C-t in the middle
+		{"\x14", "", 0},                                 // C-t on nothing
+	}
+
+	for _, c := range cases {
+		defaultConsole.state.killRing = defaultConsole.state.killRing[:0]
+		line := newLine()
+		for i := 0; i < len(c.keys); i++ {
+			line.handleInput(c.keys[i], tc)
+		}
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("editing %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+	}
+}
+
+func TestYankPop(t *testing.T) {
+	tc := NilTabComplete
+	defaultConsole.state.killRing = defaultConsole.state.killRing[:0]
+	line := newLine()
+
+	cases := []struct {
+		keys     string
+		expected string
+	}{
+		{"first\x15", ""},
+		{"second\x15", ""},
+		{"\x19", "second"},
+		{"\x1by", "first"},
+		{"\x1by", "second"},
+		{"!\x1by", "second!"}, // only right after a yank
+	}
+
+	for _, c := range cases {
+		for i := 0; i < len(c.keys); i++ {
+			line.handleInput(c.keys[i], tc)
+		}
+		if line.input != c.expected {
+			t.Errorf("yank %q = %q, want %q", c.keys, line.input, c.expected)
+		}
+	}
+}
+
+func TestEndOfInput(t *testing.T) {
+	tc := NilTabComplete
+	line := newLine()
+	if !line.handleInput(0x04, tc) || !line.eof {
+		t.Errorf("C-d on an empty line did not end input")
+	}
+}
+
+func TestBindKey(t *testing.T) {
+	defer func() { defaultConsole.state.keymap = copyKeymap(defaultKeymap) }()
+	tc := NilTabComplete
+
+	cases := []struct {
+		key     string
+		action  string
+		isError bool
+	}{
+		{"C-x", "end-of-line", false},
+		{"M-x", "beginning-of-line", false},
+		{"M-Left", "backward-word", false},
+		{"C-xx", "end-of-line", true},
+		{"C-x C-k", "kill-line", false},
+		{"C-x Foo", "kill-line", true},
+		{"Foo", "end-of-line", true},
+		{"C-a", "no-such-action", true},
+	}
+	for _, c := range cases {
+		err := BindKey(c.key, c.action)
+		if (err != nil) != c.isError {
+			t.Errorf("BindKey(%q, %q) == %v, want error %v",
+				c.key, c.action, err, c.isError)
+		}
+	}
+
+	line := newLine()
+	for _, b := range []byte("abc\x18") {
+		line.handleInput(b, tc)
+	}
+	if line.cursor != 3 {
+		t.Errorf("rebound C-x moved cursor to %v, want 3", line.cursor)
+	}
+	for _, b := range []byte("\x1bx") {
+		line.handleInput(b, tc)
+	}
+	if line.cursor != 0 {
+		t.Errorf("rebound M-x moved cursor to %v, want 0", line.cursor)
+	}
+}
@@ -0,0 +1,278 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+	Colours and text attributes. A style is a space separated list of words,
+	at most one of them a colour and the others attributes, e.g. "bold red" or
+	"underline #ff8700". A colour is one of
+
+		The 16 ANSI names: black, red, green, yellow, blue, magenta, cyan,
+		white, and the same with bright in front, e.g. brightred
+		A 256 colour index, 0 to 255
+		A truecolour, #rrggbb
+
+	The attributes are bold, dim, italic, underline, blink and reverse. An
+	empty style leaves the terminal's default.
+
+	Colours the terminal cannot show are replaced by the nearest one it can:
+	truecolour by the 256 colour palette and that by the 16 ANSI colours.
+*/
+
+const (
+	colorsANSI = iota // 16 colours
+	colors256
+	colorsTrue
+)
+
+const (
+	colorDefault = iota
+	colorANSI
+	colorIndexed
+	colorRGB
+)
+
+// A colour of one of the kinds above. index is the ANSI or 256 palette
+// index, r, g and b are only used by truecolour.
+type termColor struct {
+	kind    int
+	index   int
+	r, g, b int
+}
+
+var (
+	// Colours the terminal can show
+	colorDepth = detectColorDepth()
+
+	ansiNames = []string{"black", "red", "green", "yellow", "blue", "magenta",
+		"cyan", "white"}
+
+	// SGR codes of the text attributes
+	attributeCodes = map[string]int{
+		"bold":      1,
+		"dim":       2,
+		"italic":    3,
+		"underline": 4,
+		"blink":     5,
+		"reverse":   7,
+	}
+
+	// How the 16 ANSI colours usually look, xterm's defaults
+	ansiPalette = [16][3]int{
+		{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+		{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+		{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+		{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+	}
+
+	// Levels of each channel in the 6x6x6 colour cube of the 256 palette
+	cubeLevels = []int{0, 95, 135, 175, 215, 255}
+)
+
+// Guess what the terminal supports from the environment
+func detectColorDepth() int {
+	switch colorTerm := os.Getenv("COLORTERM"); {
+	case colorTerm == "truecolor" || colorTerm == "24bit":
+		return colorsTrue
+	case strings.Contains(os.Getenv("TERM"), "256color"):
+		return colors256
+	}
+	return colorsANSI
+}
+
+// Check that a style only holds known colours and attributes
+func CheckColor(style string) error {
+	_, _, err := parseStyle(style)
+	return err
+}
+
+// Parse a style into its colour and the SGR codes of its attributes
+func parseStyle(style string) (termColor, []int, error) {
+	var found termColor
+	attributes := make([]int, 0, 2)
+	for _, word := range strings.Fields(strings.ToLower(style)) {
+		if code, ok := attributeCodes[word]; ok {
+			attributes = append(attributes, code)
+			continue
+		}
+		parsed, err := parseColor(word)
+		if err != nil {
+			return found, attributes, err
+		}
+		if found.kind != colorDefault {
+			return found, attributes, errors.New(fmt.Sprintf(
+				"More than one colour in '%v'", style))
+		}
+		found = parsed
+	}
+	return found, attributes, nil
+}
+
+func parseColor(name string) (termColor, error) {
+	for i, ansi := range ansiNames {
+		if name == ansi {
+			return termColor{kind: colorANSI, index: i}, nil
+		} else if name == "bright"+ansi {
+			return termColor{kind: colorANSI, index: i + 8}, nil
+		}
+	}
+	if index, err := strconv.Atoi(name); err == nil && index >= 0 && index < 256 {
+		return termColor{kind: colorIndexed, index: index}, nil
+	}
+	if len(name) == 7 && name[0] == '#' {
+		if rgb, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return termColor{kind: colorRGB, r: int(rgb >> 16), g: int(rgb >> 8 & 0xff),
+				b: int(rgb & 0xff)}, nil
+		}
+	}
+	return termColor{}, errors.New(fmt.Sprintf("Unknown colour '%v'", name))
+}
+
+// The colour, replaced by the nearest one if the terminal can't show it
+func (c termColor) downgrade(depth int) termColor {
+	if c.kind == colorRGB && depth < colorsTrue {
+		c = termColor{kind: colorIndexed, index: nearest256(c.r, c.g, c.b)}
+	}
+	if c.kind == colorIndexed && depth < colors256 {
+		if c.index < 16 {
+			return termColor{kind: colorANSI, index: c.index}
+		}
+		r, g, b := paletteRGB(c.index)
+		return termColor{kind: colorANSI, index: nearestANSI(r, g, b)}
+	}
+	return c
+}
+
+// SGR parameters selecting the colour, empty for the default
+func (c termColor) sgr(background bool) string {
+	base := 30
+	if background {
+		base = 40
+	}
+	switch c.kind {
+	case colorANSI:
+		if c.index >= 8 {
+			return strconv.Itoa(base + 60 + c.index - 8)
+		}
+		return strconv.Itoa(base + c.index)
+	case colorIndexed:
+		return fmt.Sprintf("%v;5;%v", base+8, c.index)
+	case colorRGB:
+		return fmt.Sprintf("%v;2;%v;%v;%v", base+8, c.r, c.g, c.b)
+	}
+	return ""
+}
+
+// SGR parameters for text in the fg style on the bg colour. Attributes may
+// be given in either.
+func styleCodes(fg string, bg string) (string, error) {
+	fgColor, attributes, err := parseStyle(fg)
+	if err != nil {
+		return "", err
+	}
+	bgColor, bgAttributes, err := parseStyle(bg)
+	if err != nil {
+		return "", err
+	}
+
+	codes := make([]string, 0, 4)
+	for _, code := range append(attributes, bgAttributes...) {
+		codes = append(codes, strconv.Itoa(code))
+	}
+	if code := fgColor.downgrade(colorDepth).sgr(false); code != "" {
+		codes = append(codes, code)
+	}
+	if code := bgColor.downgrade(colorDepth).sgr(true); code != "" {
+		codes = append(codes, code)
+	}
+	return strings.Join(codes, ";"), nil
+}
+
+// Wrap text in the escape sequences for the styles. Unknown colours are
+// left out, they are reported when a segment is created.
+func colorize(text string, fg string, bg string) string {
+	if color.NoColor {
+		return text
+	}
+	codes, _ := styleCodes(fg, bg)
+	if codes == "" {
+		return text
+	}
+	return ESCSEQ + codes + "m" + text + ESCSEQ + "0m"
+}
+
+// Red, green and blue of a 256 palette colour
+func paletteRGB(index int) (int, int, int) {
+	switch {
+	case index < 16:
+		return ansiPalette[index][0], ansiPalette[index][1], ansiPalette[index][2]
+	case index < 232:
+		index -= 16
+		return cubeLevels[index/36], cubeLevels[index/6%6], cubeLevels[index%6]
+	}
+	gray := 8 + (index-232)*10
+	return gray, gray, gray
+}
+
+// Index of the 256 palette colour closest to r, g, b, from the colour cube
+// or the grays
+func nearest256(r, g, b int) int {
+	cube := 16 + 36*nearestLevel(r) + 6*nearestLevel(g) + nearestLevel(b)
+	average := (r + g + b) / 3
+	gray := 232 + (average-3)/10
+	if gray < 232 {
+		gray = 232
+	} else if gray > 255 {
+		gray = 255
+	}
+	cr, cg, cb := paletteRGB(cube)
+	gr, gg, gb := paletteRGB(gray)
+	if colorDistance(r, g, b, gr, gg, gb) < colorDistance(r, g, b, cr, cg, cb) {
+		return gray
+	}
+	return cube
+}
+
+// Index of the cube level closest to a channel value
+func nearestLevel(value int) int {
+	best := 0
+	for i, level := range cubeLevels {
+		if abs(level-value) < abs(cubeLevels[best]-value) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Index of the ANSI colour closest to r, g, b
+func nearestANSI(r, g, b int) int {
+	best := 0
+	for i, rgb := range ansiPalette {
+		if colorDistance(r, g, b, rgb[0], rgb[1], rgb[2]) <
+			colorDistance(r, g, b, ansiPalette[best][0], ansiPalette[best][1],
+				ansiPalette[best][2]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Squared distance between two colours, weighted for how the eye sees them
+func colorDistance(r1, g1, b1, r2, g2, b2 int) int {
+	dr, dg, db := r1-r2, g1-g2, b1-b2
+	return 3*dr*dr + 4*dg*dg + 2*db*db
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"github.com/fatih/color"
+	"testing"
+)
+
+func TestStyleCodes(t *testing.T) {
+	defer func(saved int) { colorDepth = saved }(colorDepth)
+	colorDepth = colorsTrue
+
+	cases := []struct {
+		fg       string
+		bg       string
+		expected string
+	}{
+		{"", "", ""},
+		{"red", "", "31"},
+		{"black", "white", "30;47"},
+		{"yellow", "cyan", "33;46"},
+		{"brightred", "brightblack", "91;100"},
+		{"Magenta", "", "35"},
+		{"208", "0", "38;5;208;48;5;0"},
+		{"#ff8700", "#000000", "38;2;255;135;0;48;2;0;0;0"},
+		{"bold", "", "1"},
+		{"bold underline green", "", "1;4;32"},
+		{"italic #0000ff", "dim red", "3;2;38;2;0;0;255;41"},
+		{"reverse blink", "", "7;5"},
+	}
+
+	for _, c := range cases {
+		got, err := styleCodes(c.fg, c.bg)
+		if err != nil || got != c.expected {
+			t.Errorf("styleCodes(%q, %q) = %q, %v, want %q", c.fg, c.bg, got, err,
+				c.expected)
+		}
+	}
+}
+
+func TestCheckColor(t *testing.T) {
+	cases := []struct {
+		style string
+		err   string
+	}{
+		{"red", ""},
+		{"bold 255", ""},
+		{"#AbCdEf", ""},
+		{"", ""},
+		{"purple", "Unknown colour 'purple'"},
+		{"256", "Unknown colour '256'"},
+		{"-1", "Unknown colour '-1'"},
+		{"#12345", "Unknown colour '#12345'"},
+		{"#gggggg", "Unknown colour '#gggggg'"},
+		{"bright", "Unknown colour 'bright'"},
+		{"red blue", "More than one colour in 'red blue'"},
+	}
+
+	for _, c := range cases {
+		err := CheckColor(c.style)
+		if (err == nil) != (c.err == "") || (err != nil && err.Error() != c.err) {
+			t.Errorf("CheckColor(%q) = %v, want %q", c.style, err, c.err)
+		}
+	}
+}
+
+func TestColorDowngrade(t *testing.T) {
+	defer func(saved int) { colorDepth = saved }(colorDepth)
+
+	cases := []struct {
+		depth    int
+		fg       string
+		expected string
+	}{
+		{colors256, "#ff8700", "38;5;208"},
+		{colors256, "#000000", "38;5;16"},
+		{colors256, "#808080", "38;5;244"},
+		{colors256, "#ff0000", "38;5;196"},
+		{colors256, "100", "38;5;100"},
+		{colors256, "red", "31"},
+		{colorsANSI, "#ff0000", "91"},
+		{colorsANSI, "#cd0000", "31"},
+		{colorsANSI, "#000000", "30"},
+		{colorsANSI, "#ffffff", "97"},
+		{colorsANSI, "9", "91"},
+		{colorsANSI, "1", "31"},
+		{colorsANSI, "46", "92"},
+		{colorsANSI, "232", "30"},
+		{colorsANSI, "brightblue", "94"},
+	}
+
+	for _, c := range cases {
+		colorDepth = c.depth
+		got, err := styleCodes(c.fg, "")
+		if err != nil || got != c.expected {
+			t.Errorf("styleCodes(%q) at depth %v = %q, %v, want %q", c.fg, c.depth,
+				got, err, c.expected)
+		}
+	}
+}
+
+func TestColorize(t *testing.T) {
+	defer func(saved bool) { color.NoColor = saved }(color.NoColor)
+
+	color.NoColor = false
+	if got := colorize("x", "bold red", "white"); got != "\x1b[1;31;47mx\x1b[0m" {
+		t.Errorf("colorize = %q, want bold red on white", got)
+	}
+	if got := colorize("x", "", ""); got != "x" {
+		t.Errorf("colorize with no style = %q, want %q", got, "x")
+	}
+	if got := colorize("x", "nosuchcolour", ""); got != "x" {
+		t.Errorf("colorize with an unknown colour = %q, want %q", got, "x")
+	}
+	color.NoColor = true
+	if got := colorize("x", "red", ""); got != "x" {
+		t.Errorf("colorize without colour = %q, want %q", got, "x")
+	}
+}
@@ -1,14 +1,35 @@
 package ui
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"sort"
 	"strings"
+	"sync"
 )
 
+var (
+	// Program started by execFallback, nil when none is running
+	runningChild *os.Process
+	// Cancels the context of the command running, nil when none is
+	cancelCommand context.CancelFunc
+	// Guards runningChild and cancelCommand, which SIGINT uses
+	childMutex sync.Mutex
+
+	// Input of the programs execFallback runs
+	commandInput io.Reader = os.Stdin
+)
+
+// Give the programs execFallback runs this input instead of gobar's stdin,
+// e.g. when gobar reads a script from stdin that they must not consume
+func SetCommandInput(input io.Reader) {
+	commandInput = input
+}
+
 func BootstrapCommands() {
 	RegisterCommand("help", "Display help information", "Show this message",
 		help, TabComplete)
@@ -16,10 +37,26 @@ func BootstrapCommands() {
 		help, TabComplete)
 
 	RegisterCommand("set", "Set a global option", "<Option name s> <Value s>",
-		setOption, NilTabComplete)
+		setOption, setTabComplete)
 
 	RegisterCommand("showOptions", "Show all configured options", "",
 		showOptions, NilTabComplete)
+	RegisterCommand("theme", "Show or change the prompt theme",
+		"[<Theme name>] - List the themes or switch to one",
+		themeCommand, themeTabComplete)
+	RegisterCommand("bind", "Show or change key bindings",
+		"[-l | <Key> [<Action>]] - List bindings, list actions, show or bind a key",
+		bind, bindTabComplete)
+
+	RegisterConfigSection("options", SetOption)
+	RegisterConfigSection("keymap", BindKey)
+	registerHistoryOptions()
+	registerViOptions()
+	registerKeyOptions()
+	registerSuggestOptions()
+	registerHighlightOptions()
+	registerThemeOptions()
+	registerRightPromptOptions()
 
 	RegisterCommand("chargen", "Generate characters to help with overflows",
 		"Generates a set of strings that could aid in developing exploits for"+
@@ -54,14 +91,50 @@ func help(command string) (string, error) {
 }
 
 func execFallback(command string) (string, error) {
-	args := strings.Fields(command)
+	args := splitWords(command)
+	for i, arg := range args {
+		args[i] = expandHome(arg)
+	}
 	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdin = os.Stdin   // Pass our stdin to cmd stdin
-	cmd.Stdout = os.Stdout // Cmd stdout to ours
-	err := cmd.Run()
+	cmd.Stdin = commandInput // Usually our stdin
+	cmd.Stdout = os.Stdout   // Cmd stdout to ours
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	setRunningChild(cmd.Process)
+	err := cmd.Wait()
+	setRunningChild(nil)
 	return "", err
 }
 
+func setRunningChild(process *os.Process) {
+	childMutex.Lock()
+	runningChild = process
+	childMutex.Unlock()
+}
+
+func setCancelCommand(cancel context.CancelFunc) {
+	childMutex.Lock()
+	cancelCommand = cancel
+	childMutex.Unlock()
+}
+
+// Cancel the context of the command running and pass SIGINT on to the
+// program execFallback is running. Ctrl+C on the terminal already reaches
+// the program, as it shares gobar's process group, so it is only passed on
+// when gobar is not reading from the terminal. Built in commands that don't
+// watch their context run to the end.
+func interruptCommand() {
+	childMutex.Lock()
+	defer childMutex.Unlock()
+	if cancelCommand != nil {
+		cancelCommand()
+	}
+	if runningChild != nil && !defaultConsole.isTerminal() {
+		runningChild.Signal(os.Interrupt)
+	}
+}
+
 func chargen(command string) (string, error) {
 	pattern := "ABCDEF0123456789"
 	ret := ""
@@ -100,6 +173,6 @@ func chargen(command string) (string, error) {
 	return ret, nil
 }
 
-func chargenTabComplete(partial string, tabcount int) string {
-	return ""
+func chargenTabComplete(input string, cursor int) []Candidate {
+	return nil
 }
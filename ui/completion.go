@@ -0,0 +1,229 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/mattn/go-runewidth"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	Tab completion. A Completer is given the input and the cursor position
+	and returns the candidates that could go there. Every candidate says which
+	part of the input it replaces, so a completer can finish a word, a path
+	component or a quoted string alike.
+
+	The first Tab inserts the longest prefix shared by all candidates. When
+	that adds nothing, the candidates are shown in a menu below the line and
+	further presses of Tab and Shift + Tab cycle through them. Any other key
+	closes the menu and keeps the selected candidate.
+*/
+
+const (
+	menuMaxRows = 10
+)
+
+var (
+	reverse = color.New(color.ReverseVideo).SprintFunc()
+)
+
+// A possible completion
+//
+//	Text:        Replaces the input from Start to End, in runes
+//	Display:     Shown in the menu, Text if empty
+//	Description: Shown next to Display in the menu, may be empty
+type Candidate struct {
+	Text        string
+	Display     string
+	Description string
+	Start       int
+	End         int
+}
+
+// Returns the completions for the input with the cursor at the given rune
+// index
+type Completer func(input string, cursor int) []Candidate
+
+// Candidates shown below the line
+//
+//	original: Line the candidates complete, before any was selected
+//	selected: Index of the selected candidate, -1 if none is
+type completionMenu struct {
+	candidates []Candidate
+	original   lineState
+	selected   int
+}
+
+func (c Candidate) display() string {
+	if c.Display == "" {
+		return c.Text
+	}
+	return c.Display
+}
+
+// Completer that never completes anything
+func NilTabComplete(input string, cursor int) []Candidate {
+	return nil
+}
+
+// Candidates for the words that start with the one under the cursor
+func completeWords(input string, cursor int, words []string,
+	descriptions map[string]string) []Candidate {
+
+	runes := []rune(input)
+	start := cursor
+	for start > 0 && runes[start-1] != ' ' {
+		start--
+	}
+	partial := string(runes[start:cursor])
+
+	candidates := make([]Candidate, 0, len(words))
+	for _, word := range words {
+		if strings.HasPrefix(word, partial) {
+			candidates = append(candidates, Candidate{word + " ", word,
+				descriptions[word], start, cursor})
+		}
+	}
+	return candidates
+}
+
+func complete(line *commandLine) {
+	line.completeNext(1)
+}
+
+func menuCompleteBackward(line *commandLine) {
+	line.completeNext(-1)
+}
+
+func isCompleteAction(action string) bool {
+	return action == "complete" || action == "menu-complete-backward"
+}
+
+// Complete the input, or move step candidates through the menu if it is
+// already showing
+func (line *commandLine) completeNext(step int) {
+	if menu := line.menu; menu != nil {
+		count := len(menu.candidates)
+		if menu.selected == -1 && step < 0 {
+			menu.selected = count - 1
+		} else {
+			menu.selected = (menu.selected + step + count) % count
+		}
+		line.applyCandidate(menu.original, menu.candidates[menu.selected])
+		return
+	}
+	if line.complete == nil {
+		return
+	}
+
+	candidates := line.complete(line.input, line.cursor)
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		line.applyCandidate(line.state(), candidates[0])
+		return
+	}
+
+	first := candidates[0]
+	prefix, ok := commonPrefix(candidates)
+	replaced := []rune(line.input)[first.Start:first.End]
+	if ok && utf8.RuneCountInString(prefix) > len(replaced) {
+		first.Text = prefix
+		line.applyCandidate(line.state(), first)
+		return
+	}
+	line.menu = &completionMenu{candidates, line.state(), -1}
+}
+
+// Replace the part of the original line the candidate covers
+func (line *commandLine) applyCandidate(original lineState, candidate Candidate) {
+	runes := []rune(original.input)
+	start, end := candidate.Start, candidate.End
+	if end > len(runes) {
+		end = len(runes)
+	}
+	if start < 0 || start > end {
+		start = end
+	}
+	line.input = string(runes[:start]) + candidate.Text + string(runes[end:])
+	line.cursor = start + utf8.RuneCountInString(candidate.Text)
+}
+
+// Longest prefix of the candidates' text. ok is false if they replace
+// different parts of the input, so have no prefix in common.
+func commonPrefix(candidates []Candidate) (prefix string, ok bool) {
+	common := []rune(candidates[0].Text)
+	for _, candidate := range candidates[1:] {
+		if candidate.Start != candidates[0].Start || candidate.End != candidates[0].End {
+			return "", false
+		}
+		text := []rune(candidate.Text)
+		n := 0
+		for n < len(common) && n < len(text) && common[n] == text[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return string(common), true
+}
+
+// Lines of the menu, laid out in as many columns as fit in width. When
+// there are more rows than fit, the page with the selected candidate is
+// shown.
+func (menu *completionMenu) render(width int) []string {
+	cells := make([]string, len(menu.candidates))
+	cellWidth := 0
+	for i, candidate := range menu.candidates {
+		cells[i] = candidate.display()
+		if candidate.Description != "" {
+			cells[i] += fmt.Sprintf("  (%v)", candidate.Description)
+		}
+		cells[i] = truncate(cells[i], width-1)
+		if w := displayWidth(cells[i]); w > cellWidth {
+			cellWidth = w
+		}
+	}
+	cellWidth += 2 // gap between columns
+
+	columns := width / cellWidth
+	if columns < 1 {
+		columns = 1
+	}
+	rows := (len(cells) + columns - 1) / columns
+
+	first := 0
+	if selected := menu.selected / columns; selected >= menuMaxRows {
+		first = selected - selected%menuMaxRows
+	}
+	last := first + menuMaxRows
+	if last > rows {
+		last = rows
+	}
+
+	lines := make([]string, 0, last-first+1)
+	for row := first; row < last; row++ {
+		text := ""
+		for i := row * columns; i < (row+1)*columns && i < len(cells); i++ {
+			cell := cells[i] + strings.Repeat(" ", cellWidth-displayWidth(cells[i]))
+			if i == menu.selected {
+				cell = reverse(cells[i]) + cell[len(cells[i]):]
+			}
+			text += cell
+		}
+		lines = append(lines, strings.TrimRight(text, " "))
+	}
+	if rows > last-first {
+		lines = append(lines, fmt.Sprintf("rows %v to %v of %v", first+1, last, rows))
+	}
+	return lines
+}
+
+// Cut text down to at most width columns
+func truncate(text string, width int) string {
+	if displayWidth(text) <= width {
+		return text
+	}
+	return runewidth.Truncate(text, width, "…")
+}
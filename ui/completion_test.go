@@ -0,0 +1,158 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTabComplete(t *testing.T) {
+	defer func(saved map[string]command) { commands = saved }(commands)
+	commands = make(map[string]command)
+	RegisterCommand("help", "Display help information", "", help, TabComplete)
+	RegisterCommand("hello", "Say hello", "", help, NilTabComplete)
+	RegisterCommand("bind", "Show or change key bindings", "", bind, bindTabComplete)
+
+	cases := []struct {
+		input    string
+		cursor   int
+		expected []string
+		start    int
+		end      int
+	}{
+		{"", 0, []string{"bind ", "hello ", "help "}, 0, 0},
+		{"he", 2, []string{"hello ", "help "}, 0, 2},
+		{"  hel", 5, []string{"hello ", "help "}, 2, 5},
+		{"hzqx", 4, []string{}, 0, 0},
+		{"help he", 7, []string{"hello ", "help "}, 5, 7},
+		{"help  b", 7, []string{"bind "}, 6, 7},
+		{"hello x", 7, []string{}, 0, 0},
+		{"nothing x", 9, []string{}, 0, 0},
+		{"bind C-x yan", 12, []string{"yank ", "yank-pop "}, 9, 12},
+		{"bind yan", 8, []string{}, 0, 0},
+		{"he rest", 2, []string{"hello ", "help "}, 0, 2},
+	}
+
+	for _, c := range cases {
+		candidates := TabComplete(c.input, c.cursor)
+		texts := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			texts = append(texts, candidate.Text)
+			if candidate.Start != c.start || candidate.End != c.end {
+				t.Errorf("TabComplete(%q, %v) %q spans %v-%v, want %v-%v", c.input,
+					c.cursor, candidate.Text, candidate.Start, candidate.End, c.start, c.end)
+			}
+		}
+		if !reflect.DeepEqual(texts, c.expected) {
+			t.Errorf("TabComplete(%q, %v) = %q, want %q", c.input, c.cursor, texts, c.expected)
+		}
+	}
+
+	if candidates := TabComplete("hel", 3); candidates[0].Description != "Say hello" ||
+		candidates[0].display() != "hello" {
+		t.Errorf("TabComplete(%q) = %+v, want display and description", "hel", candidates[0])
+	}
+}
+
+func TestLineComplete(t *testing.T) {
+	tc := func(input string, cursor int) []Candidate {
+		return completeWords(input, cursor,
+			[]string{"cat", "chargen", "chmod", "chown", "cp"}, nil)
+	}
+
+	cases := []struct {
+		keys     string
+		expected string
+		cursor   int
+		menu     bool
+	}{
+		{"ca\t", "cat ", 4, false},
+		{"x\t", "x", 1, false},
+		{"c\t", "c", 1, true},
+		{"ch\t", "ch", 2, true},
+		{"cho\t", "chown ", 6, false},
+		{"c\t\t", "cat ", 4, true},
+		{"c\t\t\t", "chargen ", 8, true},
+		{"c\t\t\t\t\t\t\t", "cat ", 4, true},
+		{"c\t" + ESCSEQ + "Z", "cp ", 3, true},
+		{"c\t\t" + ESCSEQ + "Z" + ESCSEQ + "Z", "chown ", 6, true},
+		{"c\t\t\tx", "chargen x", 9, false},
+		{"c\t\t\t\x1f", "c", 1, false},
+		{"a c\t\t\x01", "a cat ", 0, false},
+		{"chxyz\x02\x02\x02\t", "chxyz", 2, true},
+		{"chxyz\x02\x02\x02\t\t", "chargen xyz", 8, true},
+	}
+
+	for _, c := range cases {
+		line := newLine()
+		typeKeys(&line, c.keys, tc)
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("complete %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+		if (line.menu != nil) != c.menu {
+			t.Errorf("complete %q menu = %v, want %v", c.keys, line.menu != nil, c.menu)
+		}
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	cases := []struct {
+		candidates []Candidate
+		prefix     string
+		ok         bool
+	}{
+		{[]Candidate{{Text: "abc"}}, "abc", true},
+		{[]Candidate{{Text: "abc"}, {Text: "abd"}, {Text: "ab"}}, "ab", true},
+		{[]Candidate{{Text: "日本"}, {Text: "日本語"}}, "日本", true},
+		{[]Candidate{{Text: "x"}, {Text: "y"}}, "", true},
+		{[]Candidate{{Text: "ab"}, {Text: "ab", Start: 1}}, "", false},
+	}
+
+	for _, c := range cases {
+		prefix, ok := commonPrefix(c.candidates)
+		if prefix != c.prefix || ok != c.ok {
+			t.Errorf("commonPrefix(%v) = %q, %v, want %q, %v",
+				c.candidates, prefix, ok, c.prefix, c.ok)
+		}
+	}
+}
+
+func TestMenuRender(t *testing.T) {
+	candidates := make([]Candidate, 0, 30)
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		candidates = append(candidates, Candidate{Text: text + " ", Display: text})
+	}
+
+	cases := []struct {
+		candidates []Candidate
+		selected   int
+		width      int
+		expected   []string
+	}{
+		{candidates, -1, 80, []string{"one    two    three  four   five"}},
+		{candidates, -1, 20, []string{"one    two", "three  four", "five"}},
+		{candidates, -1, 5, []string{"one", "two", "thr…", "four", "five"}},
+		{candidates[:2], 1, 80, []string{"one  two"}},
+		{[]Candidate{{Text: "ls", Description: "List files"}, {Text: "cp"}}, -1, 80,
+			[]string{"ls  (List files)  cp"}},
+		{[]Candidate{{Text: "a-very-long-name"}}, -1, 8, []string{"a-very…"}},
+	}
+
+	for _, c := range cases {
+		menu := completionMenu{c.candidates, lineState{}, c.selected}
+		got := menu.render(c.width)
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("render(%v, %v) = %q, want %q", len(c.candidates), c.width, got, c.expected)
+		}
+	}
+
+	// Long menus show the page with the selected candidate
+	many := make([]Candidate, 25)
+	for i := range many {
+		many[i] = Candidate{Text: "x"}
+	}
+	menu := completionMenu{many, lineState{}, 12}
+	if got := menu.render(1); len(got) != 11 || got[10] != "rows 11 to 20 of 25" {
+		t.Errorf("render of 25 rows = %q, want rows 11 to 20", got)
+	}
+}
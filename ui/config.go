@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	configSections = make(map[string]func(key string, value string) error)
+	configFamilies = make(map[string]func(name, key, value string) error)
+)
+
+// Register a handler for the 'key = value' lines of a configuration section
+func RegisterConfigSection(name string, handler func(string, string) error) {
+	configSections[name] = handler
+}
+
+// Register a handler for the sections named '<kind> <name>', such as
+// [theme dark]. The handler is given the name along with each key and value.
+func RegisterConfigFamily(kind string, handler func(string, string, string) error) {
+	configFamilies[kind] = handler
+}
+
+// Load an ini style configuration file. Lines starting with ';' or '#' are
+// comments. A missing file is not an error.
+func LoadConfig(path string) error {
+	file, err := os.Open(expandHome(path))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		err := parseConfigLine(scanner.Text(), &section)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v:%v: %v", path, lineno, err))
+		}
+	}
+	return scanner.Err()
+}
+
+// Handle a single configuration line, tracking the current section
+func parseConfigLine(text string, section *string) error {
+	text = strings.TrimSpace(text)
+	if len(text) == 0 || text[0] == ';' || text[0] == '#' {
+		return nil
+	}
+
+	if text[0] == '[' {
+		if text[len(text)-1] != ']' {
+			return errors.New(fmt.Sprintf("Malformed section '%v'", text))
+		}
+		*section = strings.TrimSpace(text[1 : len(text)-1])
+		return nil
+	}
+
+	fields := strings.Fields(*section)
+	if len(fields) == 0 {
+		// Before the first section, or under []
+		return errors.New(fmt.Sprintf("Unknown section '%v'", *section))
+	}
+	handler, ok := configSections[*section]
+	kind := fields[0]
+	family, inFamily := configFamilies[kind]
+	if !ok && !inFamily {
+		return errors.New(fmt.Sprintf("Unknown section '%v'", *section))
+	}
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 {
+		return errors.New(fmt.Sprintf("Expected 'key = value', got '%v'", text))
+	}
+	key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if ok {
+		return handler(key, value)
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(*section, kind))
+	if name == "" {
+		return errors.New(fmt.Sprintf("Section '%v' needs a name", *section))
+	}
+	return family(name, key, value)
+}
+
+// Replace a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + path[1:]
+}
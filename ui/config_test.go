@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"testing"
+)
+
+func TestParseConfigLine(t *testing.T) {
+	got := make(map[string]string)
+	RegisterConfigSection("test", func(key, value string) error {
+		got[key] = value
+		return nil
+	})
+	defer delete(configSections, "test")
+
+	cases := []struct {
+		line    string
+		section string
+		key     string
+		value   string
+		isError bool
+	}{
+		{"; comment", "", "", "", false},
+		{"early = value", "", "", "", true},
+		{"[test]", "test", "", "", false},
+		{"  [ test ]  ", "test", "", "", false},
+		{"name = value", "test", "name", "value", false},
+		{"spaced=  a b c ", "test", "spaced", "a b c", false},
+		{"novalue", "test", "", "", true},
+		{"[broken", "test", "", "", true},
+		{"[missing]", "missing", "", "", false},
+		{"key = value", "missing", "", "", true},
+		{"[]", "", "", "", false},
+		{"key = value", "", "", "", true},
+	}
+
+	section := ""
+	for _, c := range cases {
+		err := parseConfigLine(c.line, &section)
+		if (err != nil) != c.isError {
+			t.Errorf("parseConfigLine(%q) error = %v, want error %v",
+				c.line, err, c.isError)
+		}
+		if section != c.section {
+			t.Errorf("parseConfigLine(%q) section = %q, want %q",
+				c.line, section, c.section)
+		}
+		if c.key != "" && got[c.key] != c.value {
+			t.Errorf("parseConfigLine(%q) %v = %q, want %q",
+				c.line, c.key, got[c.key], c.value)
+		}
+	}
+}
+
+func TestConfigFamily(t *testing.T) {
+	got := make(map[string]string)
+	RegisterConfigFamily("test", func(name, key, value string) error {
+		got[name+"."+key] = value
+		return nil
+	})
+	defer delete(configFamilies, "test")
+
+	cases := []struct {
+		line    string
+		key     string
+		value   string
+		isError bool
+	}{
+		{"[test one]", "", "", false},
+		{"a = 1", "one.a", "1", false},
+		{"[ test  two ]", "", "", false},
+		{"a = 2", "two.a", "2", false},
+		{"[test]", "", "", false},
+		{"a = 3", "", "", true},
+		{"[testing x]", "", "", false},
+		{"a = 4", "", "", true},
+	}
+
+	section := ""
+	for _, c := range cases {
+		err := parseConfigLine(c.line, &section)
+		if (err != nil) != c.isError {
+			t.Errorf("parseConfigLine(%q) error = %v, want error %v",
+				c.line, err, c.isError)
+		}
+		if c.key != "" && got[c.key] != c.value {
+			t.Errorf("parseConfigLine(%q) %v = %q, want %q",
+				c.line, c.key, got[c.key], c.value)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	A Console is a line editor on any input and output, so gobar can be
+	embedded, driven over a network connection or tested without a terminal.
+	The package level GetUserInput, Output, Error, Notify, DisplayPrompt and
+	Exit use a default Console on stdin and stdout.
+
+	A Console can be written to from any goroutine: its mutex is held while
+	anything is drawn, and Notify prints a message above the line being
+	edited and draws the line again.
+
+	Each Console has its own history, kill ring and key bindings. Only the
+	default Console reads and saves the history file, and the bind command,
+	the [keymap] section and the history options change the default
+	Console's.
+
+	Only a Console on os.Stdin switches the terminal into raw mode. Any other
+	input is expected to deliver keys as they are typed, with no escape
+	timeout: a lone Esc is seen when the next key arrives.
+*/
+
+// A line editor
+//
+//	in:       Keys are read from here
+//	out:      The prompt, the input and messages are written here
+//	size:     Returns the size of the output, in columns and rows
+//	prepared: The terminal has been set up for line editing
+//	paste:    Bracketed paste is enabled
+//	editing:  Copy of the line being edited, nil when none is
+//	prompts:  Prompt of the line being edited
+//	row:      Row of the cursor, counted from the line's first row
+//	rows:     Number of rows the line takes when it wraps
+//	state:    History, kill ring, key bindings and the vi change to repeat,
+//	          kept from line to line
+//	mutex:    Held while drawing, guards prepared, editing and prompts
+type Console struct {
+	in       io.Reader
+	out      io.Writer
+	size     func() (columns int, rows int)
+	prepared bool
+	paste    bool
+	editing  *commandLine
+	prompts  []PromptSegment
+	row      int
+	rows     int
+	state    *editorState
+	mutex    sync.Mutex
+}
+
+// What a console keeps from one line to the next
+//
+//	history:      Commands entered
+//	killRing:     Killed text, for yanking
+//	keymap:       Key bindings, key names to editing actions
+//	historyRead:  The history file was read, or reading it failed, or the
+//	              console does not use it
+//	historySaved: New commands are appended to the history file
+//	viLastChange: Last change made in vi normal state, repeated by '.'
+type editorState struct {
+	history      *history
+	killRing     []string
+	keymap       map[string]string
+	historyRead  bool
+	historySaved bool
+	viLastChange viChange
+}
+
+var (
+	defaultConsole = newDefaultConsole()
+)
+
+// Create a console reading keys from in and drawing to out. size returns the
+// number of columns and rows of the output, if nil an 80x24 screen is assumed.
+// The console starts with an empty history that is not saved.
+func NewConsole(in io.Reader, out io.Writer, size func() (int, int)) *Console {
+	if size == nil {
+		size = func() (int, int) { return 80, 24 }
+	}
+	return &Console{in: in, out: out, size: size, rows: 1, state: newEditorState()}
+}
+
+// The console on stdin and stdout, which reads the history file before its
+// first line and saves commands to it
+func newDefaultConsole() *Console {
+	console := NewConsole(os.Stdin, os.Stdout, stdoutSize)
+	console.state.historyRead = false
+	return console
+}
+
+func newEditorState() *editorState {
+	history := newHistory(historySize)
+	return &editorState{
+		history:     &history,
+		killRing:    make([]string, 0, killRingSize),
+		keymap:      copyKeymap(defaultKeymap),
+		historyRead: true,
+	}
+}
+
+// The console used by the package level functions
+func DefaultConsole() *Console {
+	return defaultConsole
+}
+
+// Is gobar reading its input from a terminal, rather than from a pipe or a
+// file
+func IsInteractive() bool {
+	return defaultConsole.isTerminal()
+}
+
+func GetUserInput(segments []PromptSegment, tabComplete Completer) string {
+	return defaultConsole.GetUserInput(segments, tabComplete)
+}
+
+func DisplayPrompt(segments []PromptSegment) {
+	defaultConsole.DisplayPrompt(segments)
+}
+
+func Exit() {
+	defaultConsole.Exit()
+}
+
+func Error(message string, uiSegments []PromptSegment) {
+	defaultConsole.Error(message, uiSegments)
+}
+
+func Output(message string, uiSegments []PromptSegment) {
+	defaultConsole.Output(message, uiSegments)
+}
+
+func Notify(message string) {
+	defaultConsole.Notify(message)
+}
+
+// End the line that was just read, before the command's output
+func EndLine() {
+	defaultConsole.write("\n")
+}
+
+func (console *Console) print(a ...interface{}) {
+	fmt.Fprint(console.out, a...)
+}
+
+// Print with the mutex held, for output that isn't part of a longer drawing
+func (console *Console) write(text string) {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	console.print(text)
+}
+
+func (console *Console) printf(format string, a ...interface{}) {
+	fmt.Fprintf(console.out, format, a...)
+}
+
+func (console *Console) width() int {
+	columns, _ := console.size()
+	if columns <= 0 {
+		return 80
+	}
+	return columns
+}
+
+// Is the console on the terminal gobar was started from
+func (console *Console) isTerminal() bool {
+	file, ok := console.in.(*os.File)
+	return ok && file == os.Stdin && isTerminal(file.Fd())
+}
+
+// Read a single byte of input. ok is false when the timeout passed first,
+// which only happens on a terminal.
+func (console *Console) readByte(timeout time.Duration) (input byte, ok bool, err error) {
+	if console.isTerminal() {
+		return readTerminalByte(timeout)
+	}
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(console.in, buf); err != nil {
+		return 0, false, err
+	}
+	return buf[0], true, nil
+}
+
+// Ask the terminal to mark pasted text with PASTE_START and PASTE_END
+func (console *Console) enablePaste() {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	if out, ok := console.out.(*os.File); ok && console.isTerminal() &&
+		isTerminal(out.Fd()) {
+
+		console.print(PASTE_ON)
+		console.paste = true
+	}
+}
+
+// Remember the line as it is drawn, so it can be drawn again by Notify and
+// after gobar is suspended. A nil line means no line is being edited. The
+// mutex must be held.
+func (console *Console) setEditing(line *commandLine, prompts []PromptSegment) {
+	if line == nil {
+		console.editing = nil
+		return
+	}
+	copied := line.snapshot()
+	console.editing = &copied
+	console.prompts = prompts
+}
+
+func (console *Console) disablePaste() {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	if console.paste {
+		console.print(PASTE_OFF)
+		console.paste = false
+	}
+}
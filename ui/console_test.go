@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConsoleGetUserInput(t *testing.T) {
+	cases := []struct {
+		keys     string
+		expected []string
+	}{
+		{"ls -la\n", []string{"ls -la", "exit"}},
+		{"one\ntwo\r", []string{"one", "two", "exit"}},
+		{"  padded  \n", []string{"padded", "exit"}},
+		{"abc\x02\x02X\n", []string{"aXbc", "exit"}},
+		{"first\n\x10\n", []string{"first", "first", "exit"}},
+		{"unfinished", []string{"exit"}},
+		{"rm -rf /tm", []string{"exit"}},
+		{"\x04", []string{"exit"}},
+		{"", []string{"exit"}},
+	}
+
+	for _, c := range cases {
+		var out bytes.Buffer
+		console := NewConsole(strings.NewReader(c.keys), &out, nil)
+		got := make([]string, 0, len(c.expected))
+		for len(got) < len(c.expected) {
+			got = append(got, console.GetUserInput(nil, NilTabComplete))
+		}
+		if strings.Join(got, "|") != strings.Join(c.expected, "|") {
+			t.Errorf("GetUserInput(%q) = %q, want %q", c.keys, got, c.expected)
+		}
+		if out.Len() == 0 {
+			t.Errorf("GetUserInput(%q) wrote nothing", c.keys)
+		}
+	}
+}
+
+func TestConsoleOutput(t *testing.T) {
+	var out bytes.Buffer
+	console := NewConsole(strings.NewReader(""), &out, nil)
+	segments := []PromptSegment{NewPromptSegment("gobar", "black", "white")}
+
+	console.Output("hello", segments)
+	console.Error("failed", segments)
+	if got := out.String(); !strings.Contains(got, "gobar") ||
+		!strings.Contains(got, "hello\n") || !strings.Contains(got, "failed\n") {
+		t.Errorf("Output and Error wrote %q", got)
+	}
+}
+
+func TestConsoleSize(t *testing.T) {
+	console := NewConsole(strings.NewReader(""), &bytes.Buffer{},
+		func() (int, int) { return 132, 50 })
+	if console.width() != 132 {
+		t.Errorf("width() = %v, want 132", console.width())
+	}
+	if console := NewConsole(strings.NewReader(""), &bytes.Buffer{}, nil); console.width() != 80 {
+		t.Errorf("width() without a size provider = %v, want 80", console.width())
+	}
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -12,8 +13,8 @@ type command struct {
 	name        string
 	description string
 	help        string
-	callback    func(input string) (string, error)
-	tabComplete func(input string, tabcount int) string
+	callback    func(ctx context.Context, input string) (string, error)
+	tabComplete Completer
 }
 
 func (cmd command) String() string {
@@ -32,20 +33,44 @@ type CommandOutput struct {
 
 var (
 	commands = make(map[string]command)
+
+	// Returned by ProcessInput when Ctrl+C cancelled the command
+	ErrInterrupted = errors.New("Interrupted")
 )
-var fallback func(string) (string, error)
+var fallback func(context.Context, string) (string, error)
 
 func RegisterCommand(name string, description string, help string,
-	callback func(string) (string, error), tabComplete func(string, int) string) {
+	callback func(string) (string, error), tabComplete Completer) {
+
+	RegisterCommandContext(name, description, help, ignoreContext(callback),
+		tabComplete)
+}
+
+// Register a command whose callback is given a context that is cancelled
+// when Ctrl+C is pressed while it runs
+func RegisterCommandContext(name string, description string, help string,
+	callback func(context.Context, string) (string, error), tabComplete Completer) {
 
 	//debug("Registering command: %v: %v", name, description)
 	commands[name] = command{name, description, help, callback, tabComplete}
 }
 
 func RegisterFallbackCommand(fb func(string) (string, error)) {
+	fallback = ignoreContext(fb)
+}
+
+// Register the fallback command with a context, as RegisterCommandContext
+func RegisterFallbackCommandContext(fb func(context.Context, string) (string, error)) {
 	fallback = fb
 }
 
+// A callback for commands that carry on through Ctrl+C
+func ignoreContext(callback func(string) (string, error)) func(context.Context, string) (string, error) {
+	return func(ctx context.Context, input string) (string, error) {
+		return callback(input)
+	}
+}
+
 // Is a command registered and valid
 func isValidCommand(command string) bool {
 	_, ok := commands[command]
@@ -68,55 +93,58 @@ func getCommandFromInput(input string) (command, error) {
 	return commands[args[0]], nil
 }
 
-// Take current user input, and expand tabs
-// If a command is already in args[0], call that command's tabComplete
-func TabComplete(partial string, tabcount int) string {
-	matches := make([]string, 0, 20)
-	args := strings.Fields(partial)
-	//debug("Tab Args: %v", args)
-
-	// Case 1: Empty string, return all available commands
-	if len(partial) == 0 || len(args) == 0 {
-		for name, _ := range commands {
-			matches = append(matches, name)
-		}
-		sort.Strings(matches)
-		return strings.Join(matches, "\t")
+// Complete the command name, or once a command is in args[0], hand its
+// arguments to that command's tabComplete. Names that are not commands
+// complete as programs on $PATH, and their arguments as paths, as they go to
+// the fallback command.
+func TabComplete(input string, cursor int) []Candidate {
+	runes := []rune(input)
+	start := 0
+	for start < cursor && runes[start] == ' ' {
+		start++
+	}
+	end := start
+	for end < cursor && runes[end] != ' ' {
+		end++
 	}
 
-	if isValidCommand(args[0]) {
-		subcmd := ""
-		if len(args) > 0 {
-			subcmd = strings.Join(args[1:], " ")
+	// Still typing the command name
+	if end == cursor {
+		partial := string(runes[start:cursor])
+		if strings.Contains(partial, "/") {
+			return CompletePath(input, cursor)
 		}
-
-		completed := (commands[args[0]]).tabComplete(subcmd, tabcount)
-		// multiple are returned
-		if strings.Index(completed, "\t") != -1 {
-			return completed
-		} else { // Only one
-			return args[0] + " " + completed
+		names := make([]string, 0, len(commands))
+		descriptions := make(map[string]string, len(commands))
+		for name, cmd := range commands {
+			names = append(names, name)
+			descriptions[name] = cmd.description
+		}
+		sort.Strings(names)
+		candidates := completeWords(string(runes[:cursor]), cursor, names, descriptions)
+		if len(candidates) == 0 && len(partial) > 0 {
+			candidates = completeWords(string(runes[:cursor]), cursor,
+				findExecutables(partial), nil)
 		}
+		return candidates
 	}
 
-	for name, _ := range commands {
-		// If the partial is shorter than the command name and matches the
-		// beginning
-		if len(args[0]) < len(name) && args[0] == name[:len(args[0])] {
-			matches = append(matches, name)
-		}
+	cmd, ok := commands[string(runes[start:end])]
+	if !ok {
+		return CompletePath(input, cursor)
+	} else if cmd.tabComplete == nil {
+		return nil
 	}
-	if tabcount == 0 && len(matches) == 1 {
-		return matches[0]
-	} else if tabcount == 1 {
-		sort.Strings(matches)
-		return strings.Join(matches, "\t")
+	// The command sees its arguments only, move the spans past the name
+	for end < cursor && runes[end] == ' ' {
+		end++
 	}
-	return partial
-}
-
-func NilTabComplete(partial string, tabcount int) string {
-	return ""
+	candidates := cmd.tabComplete(string(runes[end:]), cursor-end)
+	for i := range candidates {
+		candidates[i].Start += end
+		candidates[i].End += end
+	}
+	return candidates
 }
 
 // Take a command, and call the appropriate command's callback
@@ -130,20 +158,29 @@ func ProcessInput(input string) (output CommandOutput, err error) {
 
 	cmd, err := getCommandFromInput(input)
 	output.StartTime = time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	setCancelCommand(cancel)
+	defer setCancelCommand(nil)
+	defer cancel()
 
 	if err == nil {
 		args := strings.Split(input, " ")
 		subcmd := strings.Join(args[1:], " ")
 		// Call function with arguments
-		output.Output, err = cmd.callback(subcmd)
+		output.Output, err = cmd.callback(ctx, subcmd)
 	} else {
 		// Invalid command
 		//output.Output = fmt.Sprintf("%v", err)
-		output.Output, err = fallback(input)
+		output.Output, err = fallback(ctx, input)
+	}
+	if ctx.Err() != nil && (err == nil || err == ctx.Err()) {
+		err = ErrInterrupted
 	}
 
 	output.EndTime = time.Now()
 	output.Time = output.EndTime.Sub(output.StartTime)
+	output.Error = err != nil
+	setLastStatus(err, output.Time)
 
 	return output, err
 }
@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Wait for ProcessInput to start the command, then press Ctrl+C
+func interruptWhenRunning(running func() bool) {
+	for {
+		childMutex.Lock()
+		started := running()
+		childMutex.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	interruptCommand()
+}
+
+func TestInterruptCommand(t *testing.T) {
+	// Not on a terminal, so SIGINT is passed on to programs
+	defer func(saved *Console) { defaultConsole = saved }(defaultConsole)
+	defaultConsole = NewConsole(strings.NewReader(""), &bytes.Buffer{}, nil)
+	defer delete(commands, "wait")
+	defer func(saved func(context.Context, string) (string, error)) {
+		fallback = saved
+	}(fallback)
+	RegisterCommandContext("wait", "", "", func(ctx context.Context, input string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, NilTabComplete)
+	RegisterFallbackCommand(execFallback)
+
+	go interruptWhenRunning(func() bool { return cancelCommand != nil })
+	if _, err := ProcessInput("wait"); err != ErrInterrupted {
+		t.Errorf("interrupted command returned %v, want %v", err, ErrInterrupted)
+	}
+
+	go interruptWhenRunning(func() bool { return runningChild != nil })
+	start := time.Now()
+	if _, err := ProcessInput("sleep 5"); err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("interrupted sleep returned %v after %v, want it killed at once", err,
+			time.Since(start))
+	}
+
+	if cancelCommand != nil || runningChild != nil {
+		t.Errorf("command still running after ProcessInput returned")
+	}
+}
+
+// Without a terminal to send it, the program gets Ctrl+C from gobar, once
+func TestInterruptChildOnce(t *testing.T) {
+	defer func(saved *Console) { defaultConsole = saved }(defaultConsole)
+	defaultConsole = NewConsole(strings.NewReader(""), &bytes.Buffer{}, nil)
+
+	// Each interrupt cuts a wait short and is counted
+	cmd := exec.Command("sh", "-c",
+		`trap 'echo int' INT; echo ready; sleep 1 & wait; sleep 1 & wait`)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	output := bufio.NewReader(stdout)
+	if line, err := output.ReadString('\n'); line != "ready\n" {
+		t.Fatalf("child said %q, %v, want %q", line, err, "ready\n")
+	}
+
+	setRunningChild(cmd.Process)
+	interruptCommand()
+	rest := &bytes.Buffer{}
+	rest.ReadFrom(output)
+	cmd.Wait()
+	setRunningChild(nil)
+	if got := strings.Count(rest.String(), "int"); got != 1 {
+		t.Errorf("child was interrupted %v times, want once", got)
+	}
+}
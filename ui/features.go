@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/fatih/color"
+	"os"
+)
+
+/*
+	What the output can show, worked out once at startup by DetectTerminal.
+	Colours are used when stdout is a terminal, NO_COLOR is not set and TERM
+	is not dumb. --color=always or --color=never overrides that.
+
+	A dumb terminal, or a stdout that is not a terminal, can't be redrawn: the
+	prompt is printed plainly and the line is read as the terminal's own line
+	editing delivers it, without raw mode, completion or suggestions.
+*/
+
+var (
+	colorMode = flag.String("color", "auto", "Use colours: auto, always or never")
+
+	// The terminal can't move the cursor or clear, so lines are not redrawn
+	plainTerminal = false
+)
+
+// Decide whether to use colours and whether the terminal can be redrawn,
+// from --color and the environment. Call after flag.Parse.
+func DetectTerminal() error {
+	terminal := isTerminal(os.Stdout.Fd())
+	useColor, err := colorWanted(*colorMode, terminal)
+	if err != nil {
+		return err
+	}
+	color.NoColor = !useColor
+	plainTerminal = isDumbTerminal() || !terminal
+	return nil
+}
+
+// Is the default console on a terminal that is read a line at a time, see
+// DetectTerminal. The terminal echoes the newline ending the line itself.
+func IsPlainTerminal() bool {
+	return defaultConsole.isPlain()
+}
+
+// Should colours be used with the --color mode, given whether the output is
+// a terminal
+func colorWanted(mode string, terminal bool) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return terminal && os.Getenv("NO_COLOR") == "" && !isDumbTerminal(), nil
+	}
+	return false, errors.New(fmt.Sprintf(
+		"Unknown colour mode '%v', use auto, always or never", mode))
+}
+
+func isDumbTerminal() bool {
+	return os.Getenv("TERM") == "dumb"
+}
+
+// Is the console on a terminal that can't be redrawn
+func (console *Console) isPlain() bool {
+	return plainTerminal && console.isTerminal()
+}
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"bytes"
+	"github.com/fatih/color"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Put an environment variable back as it was, unset if it was not set
+func restoreEnv(name string) func() {
+	value, set := os.LookupEnv(name)
+	return func() {
+		if set {
+			os.Setenv(name, value)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestColorWanted(t *testing.T) {
+	defer restoreEnv("NO_COLOR")()
+	defer restoreEnv("TERM")()
+
+	cases := []struct {
+		mode     string
+		terminal bool
+		noColor  string
+		term     string
+		expected bool
+		err      string
+	}{
+		{"auto", true, "", "xterm", true, ""},
+		{"auto", false, "", "xterm", false, ""},
+		{"auto", true, "1", "xterm", false, ""},
+		{"auto", true, "", "dumb", false, ""},
+		{"always", false, "1", "dumb", true, ""},
+		{"never", true, "", "xterm", false, ""},
+		{"sometimes", true, "", "xterm", false,
+			"Unknown colour mode 'sometimes', use auto, always or never"},
+	}
+
+	for _, c := range cases {
+		os.Setenv("NO_COLOR", c.noColor)
+		os.Setenv("TERM", c.term)
+		got, err := colorWanted(c.mode, c.terminal)
+		if got != c.expected || (err == nil) != (c.err == "") ||
+			(err != nil && err.Error() != c.err) {
+			t.Errorf("colorWanted(%q, %v) with NO_COLOR=%q TERM=%q = %v, %v, want %v, %q",
+				c.mode, c.terminal, c.noColor, c.term, got, err, c.expected, c.err)
+		}
+	}
+}
+
+func TestGetPlainInput(t *testing.T) {
+	defer func(saved bool) { color.NoColor = saved }(color.NoColor)
+	defer func(saved string) { *prompt_end = saved }(*prompt_end)
+	color.NoColor = true
+	*prompt_end = ">"
+
+	cases := []struct {
+		keys     string
+		expected []string
+	}{
+		{"ls -la\n", []string{"ls -la", "exit"}},
+		{"one\r\ntwo\n", []string{"one", "two", "exit"}},
+		{"unfinished", []string{"exit"}},
+		{"", []string{"exit"}},
+	}
+
+	for _, c := range cases {
+		var out bytes.Buffer
+		console := NewConsole(strings.NewReader(c.keys), &out, nil)
+		prompts := []PromptSegment{NewPromptSegment("gobar", "black", "white")}
+		got := make([]string, 0, len(c.expected))
+		for len(got) < len(c.expected) {
+			got = append(got, console.getPlainInput(prompts))
+		}
+		if strings.Join(got, "|") != strings.Join(c.expected, "|") {
+			t.Errorf("getPlainInput(%q) = %q, want %q", c.keys, got, c.expected)
+		}
+		expected := strings.Repeat("gobar > ", len(c.expected))
+		if out.String() != expected {
+			t.Errorf("getPlainInput(%q) drew %q, want %q", c.keys, out.String(), expected)
+		}
+	}
+}
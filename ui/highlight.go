@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+/*
+	Syntax highlighting of the input line. The first word of every command,
+	at the start of a line or after a ;, is coloured by what running it
+	would do: a registered command, a program that execFallback would run,
+	or nothing at all. Quoted strings, $variables and options in the other
+	words get colours of their own.
+*/
+
+var (
+	highlightEnabled = true
+
+	// Foreground colour of each kind of text, as understood by colorize
+	highlightColors = map[string]string{
+		"command":    "green",
+		"executable": "blue",
+		"unknown":    "red",
+		"string":     "yellow",
+		"variable":   "magenta",
+		"option":     "cyan",
+	}
+)
+
+func registerHighlightOptions() {
+	RegisterBoolOption("highlight", "Colour the input line while typing, on or off",
+		&highlightEnabled)
+}
+
+// The input as it is displayed, with colours. What the command words run is
+// looked up in kinds first and added to it, kinds may be nil.
+func highlightInput(input string, kinds map[string]string) string {
+	if !highlightEnabled {
+		return renderInput(input)
+	}
+
+	highlighted := ""
+	runes := []rune(input)
+	first := true // the next word is a command
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) || runes[i] == ';' {
+			// A new command starts after these, as SplitCommands has it
+			first = first || runes[i] == '\n' || runes[i] == ';'
+			highlighted += renderInput(string(runes[i]))
+			i++
+			continue
+		}
+		end := shellWordEnd(runes, i)
+		if separator := commandSeparator(runes[i:end]); separator != -1 {
+			end = i + separator
+		}
+		word := string(runes[i:end])
+		if first {
+			kind := commandKind(unquoteWord(word), kinds)
+			highlighted += colorize(renderInput(word), highlightColors[kind], "")
+		} else {
+			highlighted += highlightWord([]rune(word))
+		}
+		first = false
+		i = end
+	}
+	return highlighted
+}
+
+// What running a word as a command would do. Searching $PATH is slow for
+// every redraw, so programs found or not are remembered in cache.
+func commandKind(name string, cache map[string]string) string {
+	if isValidCommand(name) || name == "exit" || name == "quit" {
+		return "command"
+	}
+	if kind, ok := cache[name]; ok {
+		return kind
+	}
+	kind := "unknown"
+	if _, err := exec.LookPath(name); err == nil {
+		kind = "executable"
+	}
+	if cache != nil {
+		cache[name] = kind
+	}
+	return kind
+}
+
+// Index of the first ; in a word that is not quoted or escaped, -1 if there
+// is none
+func commandSeparator(word []rune) int {
+	var quote rune
+	for i := 0; i < len(word); i++ {
+		switch {
+		case word[i] == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if word[i] == quote {
+				quote = 0
+			}
+		case word[i] == '\'' || word[i] == '"':
+			quote = word[i]
+		case word[i] == ';':
+			return i
+		}
+	}
+	return -1
+}
+
+// Colour the strings and variables in an argument. The rest of it is plain,
+// or an option if the argument starts with '-'.
+func highlightWord(word []rune) string {
+	plain := ""
+	if len(word) > 1 && word[0] == '-' {
+		plain = highlightColors["option"]
+	}
+
+	highlighted := ""
+	for i := 0; i < len(word); {
+		end := i + 1
+		kind := ""
+		switch word[i] {
+		case '\'', '"':
+			for end < len(word) && word[end] != word[i] {
+				end++
+			}
+			if end < len(word) {
+				end++ // closing quote
+			}
+			kind = highlightColors["string"]
+		case '$':
+			end = variableEnd(word, i)
+			kind = highlightColors["variable"]
+		default:
+			end = i
+			for end < len(word) && !strings.ContainsRune("'\"$", word[end]) {
+				if word[end] == '\\' {
+					end++ // escaped, even if it is a quote
+				}
+				end++
+			}
+			if end > len(word) {
+				end = len(word)
+			}
+			kind = plain
+		}
+		highlighted += colorize(renderInput(string(word[i:end])), kind, "")
+		i = end
+	}
+	return highlighted
+}
+
+// Index just past a variable reference, $name or ${name}
+func variableEnd(word []rune, start int) int {
+	end := start + 1
+	if end < len(word) && word[end] == '{' {
+		for end < len(word) && word[end] != '}' {
+			end++
+		}
+		if end < len(word) {
+			end++
+		}
+		return end
+	}
+	for end < len(word) && (word[end] == '_' || isWordRune(word[end])) {
+		end++
+	}
+	return end
+}
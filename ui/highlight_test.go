@@ -0,0 +1,66 @@
+package ui
+
+import (
+	"github.com/fatih/color"
+	"os"
+	"testing"
+)
+
+func TestHighlightInput(t *testing.T) {
+	defer func(saved bool) { color.NoColor = saved }(color.NoColor)
+	color.NoColor = false
+	defer func(saved map[string]command) { commands = saved }(commands)
+	commands = map[string]command{"help": command{name: "help"}}
+
+	sgr := func(code string, text string) string {
+		return "\x1b[" + code + "m" + text + "\x1b[0m"
+	}
+
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"help", sgr("32", "help")},
+		{"  help me", "  " + sgr("32", "help") + " me"},
+		{"sh", sgr("34", "sh")},
+		{"no-such-command-here", sgr("31", "no-such-command-here")},
+		{"help -v --all", sgr("32", "help") + " " + sgr("36", "-v") + " " + sgr("36", "--all")},
+		{"help 'a b' \"c", sgr("32", "help") + " " + sgr("33", "'a b'") + " " + sgr("33", "\"c")},
+		{"help $HOME ${A}x", sgr("32", "help") + " " + sgr("35", "$HOME") + " " + sgr("35", "${A}") + "x"},
+		{"help a$B'c'", sgr("32", "help") + " a" + sgr("35", "$B") + sgr("33", "'c'")},
+		{"help x\nsh", sgr("32", "help") + " x↵" + sgr("34", "sh")},
+		{"help; no-such-command-here", sgr("32", "help") + "; " + sgr("31", "no-such-command-here")},
+		{"help x;sh", sgr("32", "help") + " x;" + sgr("34", "sh")},
+		{"help 'a;b' \\;c", sgr("32", "help") + " " + sgr("33", "'a;b'") + " \\;c"},
+	}
+
+	for _, c := range cases {
+		got := highlightInput(c.input, nil)
+		if got != c.expected {
+			t.Errorf("highlightInput(%q) = %q, want %q", c.input, got, c.expected)
+		}
+	}
+
+	highlightEnabled = false
+	defer func() { highlightEnabled = true }()
+	if got := highlightInput("help\tme", nil); got != "help⇥me" {
+		t.Errorf("highlightInput with highlighting off = %q, want %q", got, "help⇥me")
+	}
+}
+
+// $PATH is searched once for each command word of a line
+func TestCommandKindCache(t *testing.T) {
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	kinds := make(map[string]string)
+	if got := commandKind("sh", kinds); got != "executable" {
+		t.Fatalf("commandKind(%q) = %q, want %q", "sh", got, "executable")
+	}
+	os.Setenv("PATH", "")
+	if got := commandKind("sh", kinds); got != "executable" {
+		t.Errorf("cached commandKind(%q) = %q, want %q", "sh", got, "executable")
+	}
+	if got := commandKind("sh", nil); got != "unknown" {
+		t.Errorf("uncached commandKind(%q) with no PATH = %q, want %q", "sh", got, "unknown")
+	}
+}
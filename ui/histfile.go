@@ -0,0 +1,197 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+	Persistent command history. Every entry is one line in the history file:
+
+		<unix timestamp> <command>
+
+	with backslashes and newlines in the command escaped. The file is only
+	ever appended to or rewritten while holding an exclusive flock, so several
+	gobar instances can share it.
+*/
+
+var (
+	historyFile = "~/.gobar_history"
+)
+
+func registerHistoryOptions() {
+	RegisterOption("histfile", "File the command history is saved to",
+		historyFile, setHistoryFile)
+	RegisterOption("histsize", "Number of commands kept in history",
+		strconv.Itoa(historySize), setHistorySize)
+}
+
+func setHistoryFile(path string) error {
+	historyFile = path
+	if defaultConsole.state.historyRead {
+		return defaultConsole.state.loadHistory()
+	}
+	return nil
+}
+
+func setHistorySize(value string) error {
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		return errors.New(fmt.Sprintf("Invalid history size '%v'", value))
+	}
+	resized := newHistory(size)
+	old := defaultConsole.state.history
+	first := 0
+	if len(old.commandHistory) > size {
+		first = len(old.commandHistory) - size
+	}
+	for i := first; i < len(old.commandHistory); i++ {
+		resized.pushAt(old.commandHistory[i], old.times[i])
+	}
+	defaultConsole.state.history = &resized
+	return nil
+}
+
+// Add a finished line to history, unless it starts with a space or repeats
+// the previous command
+func (console *Console) recordHistory(command string) {
+	if len(command) == 0 || command[0] == ' ' {
+		return
+	}
+	state := console.state
+	items := state.history.commandHistory
+	duplicate := len(items) > 0 && items[len(items)-1] == command
+	state.history.push(command)
+	if !duplicate && state.historySaved {
+		if err := appendHistory(command, time.Now()); err != nil {
+			console.warning("Unable to save history: %v", err)
+		}
+	}
+}
+
+// Replace the in memory history with the contents of the history file,
+// trimming the file down to the history size
+func (state *editorState) loadHistory() error {
+	state.historySaved = false
+	file, err := openHistory(os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Read line by line rather than with a Scanner, a long pasted command
+	// must not stop the rest of the history from loading
+	var commands []string
+	var times []time.Time
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if when, command, ok := parseHistoryLine(strings.TrimSuffix(line, "\n")); ok {
+			commands = append(commands, command)
+			times = append(times, when)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	size := cap(state.history.commandHistory)
+	loaded := newHistory(size)
+	first := 0
+	if len(commands) > size {
+		first = len(commands) - size
+	}
+	for i := first; i < len(commands); i++ {
+		loaded.pushAt(commands[i], times[i])
+	}
+	if first > 0 {
+		if err := rewriteHistory(file, &loaded); err != nil {
+			return err
+		}
+	}
+	state.history = &loaded
+	state.historySaved = true
+	return nil
+}
+
+// Append a single command to the history file
+func appendHistory(command string, when time.Time) error {
+	file, err := openHistory(os.O_WRONLY | os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.WriteString(file, formatHistoryLine(command, when)+"\n")
+	return err
+}
+
+// Open the history file and take an exclusive lock on it. The lock is
+// released when the file is closed.
+func openHistory(flags int) (*os.File, error) {
+	file, err := os.OpenFile(expandHome(historyFile), flags|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// Replace the contents of a locked history file with the history, each
+// command with the time it was entered
+func rewriteHistory(file *os.File, hist *history) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for i, command := range hist.commandHistory {
+		writer.WriteString(formatHistoryLine(command, hist.times[i]) + "\n")
+	}
+	return writer.Flush()
+}
+
+func formatHistoryLine(command string, when time.Time) string {
+	escaped := strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(command)
+	return fmt.Sprintf("%d %v", when.Unix(), escaped)
+}
+
+// Returns the timestamp and command of a history file line, ok is false if
+// the line is malformed
+func parseHistoryLine(line string) (when time.Time, command string, ok bool) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return when, "", false
+	}
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts[1]) == 0 {
+		return when, "", false
+	}
+
+	// Undo the escaping done by formatHistoryLine
+	unescaped := make([]byte, 0, len(parts[1]))
+	for i := 0; i < len(parts[1]); i++ {
+		c := parts[1][i]
+		if c == '\\' && i+1 < len(parts[1]) {
+			i++
+			if c = parts[1][i]; c == 'n' {
+				c = '\n'
+			}
+		}
+		unescaped = append(unescaped, c)
+	}
+	return time.Unix(seconds, 0), string(unescaped), true
+}
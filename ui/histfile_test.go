@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryLineFormat(t *testing.T) {
+	when := time.Unix(1500000000, 0)
+	cases := []struct {
+		command string
+		line    string
+	}{
+		{"ls -la", "1500000000 ls -la"},
+		{"echo a\\nb", "1500000000 echo a\\\\nb"},
+		{"for i in 1 2\ndo echo $i\ndone", "1500000000 for i in 1 2\\ndo echo $i\\ndone"},
+	}
+
+	for _, c := range cases {
+		got := formatHistoryLine(c.command, when)
+		if got != c.line {
+			t.Errorf("formatHistoryLine(%q) == %q, want %q", c.command, got, c.line)
+		}
+		parsedWhen, command, ok := parseHistoryLine(got)
+		if !ok || command != c.command || !parsedWhen.Equal(when) {
+			t.Errorf("parseHistoryLine(%q) == %v, %q, %v, want %v, %q, true",
+				got, parsedWhen, command, ok, when, c.command)
+		}
+	}
+
+	for _, bad := range []string{"", "ls", "abc ls", "1500000000 "} {
+		if _, _, ok := parseHistoryLine(bad); ok {
+			t.Errorf("parseHistoryLine(%q) accepted a malformed line", bad)
+		}
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(saved string) { historyFile = saved }(historyFile)
+	historyFile = filepath.Join(dir, "history")
+	console := NewConsole(nil, &bytes.Buffer{}, nil)
+	reset := func() {
+		history := newHistory(3)
+		console.state.history = &history
+	}
+
+	reset()
+	if err := console.state.loadHistory(); err != nil {
+		t.Fatalf("loadHistory() == %v", err)
+	}
+	for _, c := range []string{"A", "B", "B", " secret", "C", "D"} {
+		console.recordHistory(c)
+	}
+
+	contents, _ := ioutil.ReadFile(historyFile)
+	if lines := strings.Count(string(contents), "\n"); lines != 4 {
+		t.Errorf("history file has %v lines, want 4:\n%s", lines, contents)
+	}
+
+	// Reloading trims the file to the history size
+	reset()
+	if err := console.state.loadHistory(); err != nil {
+		t.Fatalf("loadHistory() == %v", err)
+	}
+	expected := []string{"B", "C", "D"}
+	for i, c := range expected {
+		if got := console.state.history.commandHistory[i]; got != c {
+			t.Errorf("history.commandHistory[%v] == %q, want %q", i, got, c)
+		}
+	}
+	contents, _ = ioutil.ReadFile(historyFile)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if _, command, _ := parseHistoryLine(lines[0]); len(lines) != 3 || command != "B" {
+		t.Errorf("history file not trimmed:\n%s", contents)
+	}
+}
+
+// Consoles other than the default one keep their history in memory
+func TestConsoleHistoryNotSaved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(saved string) { historyFile = saved }(historyFile)
+	historyFile = filepath.Join(dir, "history")
+
+	console := NewConsole(strings.NewReader("ls\n"), &bytes.Buffer{}, nil)
+	if input := console.GetUserInput(nil, NilTabComplete); input != "ls" {
+		t.Fatalf("GetUserInput() == %q, want %q", input, "ls")
+	}
+	if _, err := os.Stat(historyFile); !os.IsNotExist(err) {
+		t.Errorf("console wrote the history file, Stat() == %v", err)
+	}
+	if got := console.state.history.commandHistory; len(got) != 1 || got[0] != "ls" {
+		t.Errorf("console history == %q, want [\"ls\"]", got)
+	}
+	if got := defaultConsole.state.history.commandHistory; len(got) != 0 {
+		t.Errorf("default console history == %q, want it empty", got)
+	}
+}
+
+// Loading keeps the last valid entries with the time they were entered, and
+// rewrites the file only when some of them were dropped
+func TestHistoryFileLoading(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(saved string) { historyFile = saved }(historyFile)
+	historyFile = filepath.Join(dir, "history")
+	long := strings.Repeat("x", 100000)
+
+	cases := []struct {
+		contents string
+		commands []string
+		times    []int64
+		written  string
+	}{
+		{"100 A\n200 B\nbad\n300 C\n400 D\n", []string{"B", "C", "D"},
+			[]int64{200, 300, 400}, "200 B\n300 C\n400 D\n"},
+		{"100 A\nbad\n200 B\n300 C\n", []string{"A", "B", "C"},
+			[]int64{100, 200, 300}, "100 A\nbad\n200 B\n300 C\n"},
+		{"100 " + long + "\n200 B", []string{long, "B"},
+			[]int64{100, 200}, "100 " + long + "\n200 B"},
+	}
+
+	for _, c := range cases {
+		if err := ioutil.WriteFile(historyFile, []byte(c.contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		console := NewConsole(nil, &bytes.Buffer{}, nil)
+		history := newHistory(3)
+		console.state.history = &history
+		if err := console.state.loadHistory(); err != nil {
+			t.Errorf("loadHistory() of %.20q == %v", c.contents, err)
+			continue
+		}
+		loaded := console.state.history
+		if len(loaded.commandHistory) != len(c.commands) {
+			t.Errorf("loading %.20q gave %v commands, want %v", c.contents,
+				len(loaded.commandHistory), len(c.commands))
+			continue
+		}
+		for i, command := range c.commands {
+			when := time.Unix(c.times[i], 0)
+			if loaded.commandHistory[i] != command || !loaded.times[i].Equal(when) {
+				t.Errorf("loading %.20q gave item %v %.20q at %v, want %.20q at %v",
+					c.contents, i, loaded.commandHistory[i], loaded.times[i], command, when)
+			}
+		}
+		written, _ := ioutil.ReadFile(historyFile)
+		if string(written) != c.written {
+			t.Errorf("history file after loading %.20q == %.40q, want %.40q", c.contents,
+				written, c.written)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Keys are named the way readline names them: C-a for Ctrl + a, M-b for
+	Alt + b, S-Tab for Shift + Tab and Up, Home, F1, ... for the special keys.
+	The keymap maps a key name to the name of an editing action, so any key
+	can be rebound with the 'bind' command or the [keymap] section of the
+	configuration file.
+
+	A binding can also be a sequence of keys separated by spaces, such as
+	"C-x C-u". The first keys of a sequence then act as a prefix and wait for
+	the next key, unless they have a binding of their own.
+*/
+
+var (
+	defaultKeymap = map[string]string{
+		"Enter":       "accept-line",
+		"C-c":         "cancel-line",
+		"Tab":         "complete",
+		"S-Tab":       "menu-complete-backward",
+		"Backspace":   "backward-delete-char",
+		"C-h":         "backward-delete-char",
+		"Delete":      "delete-char",
+		"C-d":         "delete-char-or-eof",
+		"Left":        "backward-char",
+		"C-b":         "backward-char",
+		"Right":       "forward-char",
+		"C-f":         "forward-char",
+		"Home":        "beginning-of-line",
+		"C-a":         "beginning-of-line",
+		"End":         "end-of-line",
+		"C-e":         "end-of-line",
+		"M-b":         "backward-word",
+		"M-f":         "forward-word",
+		"Up":          "previous-history",
+		"C-p":         "previous-history",
+		"Down":        "next-history",
+		"C-n":         "next-history",
+		"C-k":         "kill-line",
+		"C-u":         "unix-line-discard",
+		"C-w":         "unix-word-rubout",
+		"M-d":         "kill-word",
+		"M-Backspace": "backward-kill-word",
+		"C-y":         "yank",
+		"M-y":         "yank-pop",
+		"C-t":         "transpose-chars",
+		"C-l":         "clear-screen",
+		"C-r":         "reverse-search-history",
+		"C-_":         "undo",
+		"C-x C-u":     "undo",
+		"C-M-_":       "redo",
+	}
+
+	// How long to wait for the rest of an escape sequence before taking ESC
+	// as the Esc key
+	escapeTimeout = 100 * time.Millisecond
+
+	// Editing actions that keys can be bound to
+	keyActions = map[string]func(line *commandLine){
+		"accept-line":            acceptLine,
+		"cancel-line":            cancelLine,
+		"complete":               complete,
+		"menu-complete-backward": menuCompleteBackward,
+		"backward-delete-char":   backwardDeleteChar,
+		"delete-char":            deleteCharAction,
+		"delete-char-or-eof":     deleteCharOrEOF,
+		"backward-char":          backwardChar,
+		"forward-char":           forwardChar,
+		"beginning-of-line":      beginningOfLine,
+		"end-of-line":            endOfLine,
+		"backward-word":          backwardWord,
+		"forward-word":           forwardWord,
+		"previous-history":       previousHistory,
+		"next-history":           nextHistory,
+		"kill-line":              killLine,
+		"unix-line-discard":      unixLineDiscard,
+		"unix-word-rubout":       unixWordRubout,
+		"kill-word":              killWord,
+		"backward-kill-word":     backwardKillWord,
+		"yank":                   yank,
+		"yank-pop":               yankPop,
+		"transpose-chars":        transposeChars,
+		"clear-screen":           clearScreenAction,
+		"reverse-search-history": reverseSearchHistory,
+		"undo":                   undo,
+		"redo":                   redo,
+	}
+)
+
+func registerKeyOptions() {
+	RegisterOption("esctimeout",
+		"Milliseconds to wait for the rest of an escape sequence",
+		strconv.Itoa(int(escapeTimeout/time.Millisecond)), setEscapeTimeout)
+}
+
+func setEscapeTimeout(value string) error {
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms <= 0 {
+		return errors.New(fmt.Sprintf("Invalid escape timeout '%v'", value))
+	}
+	escapeTimeout = time.Duration(ms) * time.Millisecond
+	return nil
+}
+
+func copyKeymap(source map[string]string) map[string]string {
+	copied := make(map[string]string, len(source))
+	for key, action := range source {
+		copied[key] = action
+	}
+	return copied
+}
+
+// Bind a key to an editing action on the default console
+func BindKey(key string, action string) error {
+	return defaultConsole.BindKey(key, action)
+}
+
+// Bind a key to an editing action
+func (console *Console) BindKey(key string, action string) error {
+	sequence, ok := parseKeySequence(key)
+	if !ok {
+		return errors.New(fmt.Sprintf("Unknown key '%v'", key))
+	}
+	if _, ok := keyActions[action]; !ok {
+		return errors.New(fmt.Sprintf("Unknown action '%v'", action))
+	}
+	console.state.keymap[sequence] = action
+	return nil
+}
+
+// Is the key the start of a longer key sequence
+func isKeyPrefix(keymap map[string]string, key string) bool {
+	if _, ok := keymap[key]; ok {
+		return false
+	}
+	for bound, _ := range keymap {
+		if strings.HasPrefix(bound, key+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// Run the action bound to a key, or the key sequence it completes
+func (line *commandLine) handleKey(key string) {
+	if line.keyPrefix != "" {
+		key = line.keyPrefix + " " + key
+		line.keyPrefix = ""
+	}
+	keymap := line.editor().keymap
+	if isKeyPrefix(keymap, key) {
+		line.keyPrefix = key
+		return
+	}
+	action := keymap[key]
+	if callback, ok := keyActions[action]; ok {
+		callback(line)
+	}
+	line.lastAction = action
+}
+
+func bind(command string) (string, error) {
+	args := strings.Fields(command)
+	last := len(args) - 1
+	switch {
+	case len(args) == 0:
+		return showBindings(), nil
+	case len(args) == 1 && args[0] == "-l":
+		return showActions(), nil
+	case len(args) > 1 && keyActions[args[last]] != nil:
+		key := strings.Join(args[:last], " ")
+		if err := BindKey(key, args[last]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v => %v", key, args[last]), nil
+	}
+	key := strings.Join(args, " ")
+	sequence, ok := parseKeySequence(key)
+	if !ok {
+		return "", errors.New("Usage: bind [-l | <Key>... [<Action>]]")
+	}
+	return fmt.Sprintf("%v = %v", key, defaultConsole.state.keymap[sequence]), nil
+}
+
+func showBindings() string {
+	keymap := defaultConsole.state.keymap
+	keys := make([]string, 0, len(keymap))
+	for key, _ := range keymap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	output := "Key bindings:"
+	for _, key := range keys {
+		output += fmt.Sprintf("\n\t%v = %v", key, keymap[key])
+	}
+	return output
+}
+
+func showActions() string {
+	actions := make([]string, 0, len(keyActions))
+	for action, _ := range keyActions {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return "Actions:\n\t" + strings.Join(actions, "\n\t")
+}
+
+// Complete action names after the key
+func bindTabComplete(input string, cursor int) []Candidate {
+	// Only once a key has been typed
+	before := string([]rune(input)[:cursor])
+	words := len(strings.Fields(before))
+	if !strings.HasSuffix(before, " ") {
+		words--
+	}
+	if words < 1 {
+		return nil
+	}
+	actions := make([]string, 0, len(keyActions))
+	for action, _ := range keyActions {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return completeWords(input, cursor, actions, nil)
+}
@@ -0,0 +1,489 @@
+package ui
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	Decoding of terminal input into key events. Handles UTF-8 characters,
+	control characters, Alt + key (ESC prefix), CSI sequences (ESC [) with
+	xterm style modifier parameters, SS3 sequences (ESC O), rxvt modifier
+	suffixes and the Linux console function keys, which between them cover
+	xterm, tmux, screen, rxvt and the Linux console.
+
+	With bracketed paste on, pasted text arrives between PASTE_START and
+	PASTE_END and is decoded as a single Paste event holding the text, so
+	nothing in it is taken as a key.
+
+	A lone ESC cannot be told apart from the start of a sequence until more
+	input arrives, so the reader calls flush when nothing follows within the
+	escape timeout. Unknown or malformed sequences are dropped, the decoder
+	never waits for more than one sequence.
+*/
+
+type keyModifier int
+
+const (
+	modShift keyModifier = 1 << iota
+	modAlt
+	modCtrl
+)
+
+// A decoded key press. Character keys have r set and key holding the
+// character, other keys have a name such as "Up" or "F5".
+type keyEvent struct {
+	key  string
+	r    rune
+	mod  keyModifier
+	text string // pasted text, for Paste events
+	data []byte // pasted bytes, for Paste events of a raw decoder
+}
+
+const (
+	decodeGround = iota
+	decodeUTF8
+	decodeEscape
+	decodeCSI
+	decodeSS3
+	decodeLinuxFn
+	decodeDiscard
+	decodePaste
+
+	maxSequenceLength = 32
+)
+
+// State of the key decoder
+//
+//	state: What the next byte is expected to be part of
+//	buf:   Bytes of the sequence or character collected so far
+//	alt:   An ESC prefix was seen, the next key is pressed with Alt
+//	raw:   Characters are left out of key and pasted text is left in buf,
+//	       so no strings are made of a secret. data of a Paste event is
+//	       only valid until the next byte is fed.
+type keyDecoder struct {
+	state int
+	buf   []byte
+	alt   bool
+	raw   bool
+}
+
+var (
+	// Keys of CSI sequences ending in a letter, e.g. ESC [ A or ESC [ 1 ; 5 A
+	csiKeys = map[byte]string{
+		'A': "Up", 'B': "Down", 'C': "Right", 'D': "Left",
+		'H': "Home", 'F': "End", 'E': "Begin",
+		'P': "F1", 'Q': "F2", 'R': "F3", 'S': "F4",
+	}
+
+	// Keys of SS3 sequences, ESC O followed by a letter
+	ss3Keys = map[byte]string{
+		'A': "Up", 'B': "Down", 'C': "Right", 'D': "Left",
+		'H': "Home", 'F': "End", 'E': "Begin", 'M': "Enter",
+		'P': "F1", 'Q': "F2", 'R': "F3", 'S': "F4",
+	}
+
+	// Keys of CSI sequences ending in ~, by their first parameter
+	tildeKeys = map[int]string{
+		1: "Home", 2: "Insert", 3: "Delete", 4: "End",
+		5: "PageUp", 6: "PageDown", 7: "Home", 8: "End",
+		11: "F1", 12: "F2", 13: "F3", 14: "F4", 15: "F5",
+		17: "F6", 18: "F7", 19: "F8", 20: "F9", 21: "F10",
+		23: "F11", 24: "F12",
+	}
+
+	// Keys with a name rather than a character
+	namedKeys = []string{
+		"Enter", "Tab", "Backspace", "Esc", "Space",
+		"Up", "Down", "Left", "Right", "Home", "End", "Begin",
+		"Insert", "Delete", "PageUp", "PageDown",
+		"F1", "F2", "F3", "F4", "F5", "F6", "F7", "F8", "F9", "F10", "F11", "F12",
+	}
+)
+
+// Name of the key as used by the keymap, e.g. "C-M-Left", "M-b" or "S-Tab"
+func (event keyEvent) String() string {
+	name := event.key
+	if event.mod&modShift != 0 {
+		name = "S-" + name
+	}
+	if event.mod&modAlt != 0 {
+		name = "M-" + name
+	}
+	if event.mod&modCtrl != 0 {
+		name = "C-" + name
+	}
+	return name
+}
+
+// Is this a character to insert into the line
+func (event keyEvent) isChar() bool {
+	return event.r != 0 && event.mod == 0
+}
+
+// Parse a key name as produced by keyEvent.String, modifiers may be given in
+// any order
+func parseKeyName(name string) (keyEvent, bool) {
+	var event keyEvent
+	for len(name) > 2 && name[1] == '-' {
+		switch name[0] {
+		case 'C':
+			event.mod |= modCtrl
+		case 'M':
+			event.mod |= modAlt
+		case 'S':
+			event.mod |= modShift
+		default:
+			return event, false
+		}
+		name = name[2:]
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		event.r, _ = utf8.DecodeRuneInString(name)
+		event.key = name
+		return event, unicode.IsPrint(event.r)
+	}
+	for _, key := range namedKeys {
+		if key == name {
+			event.key = name
+			return event, true
+		}
+	}
+	return event, false
+}
+
+// Parse a sequence of space separated key names, such as "C-x C-u", into
+// its canonical form
+func parseKeySequence(names string) (string, bool) {
+	keys := strings.Fields(names)
+	if len(keys) == 0 {
+		return "", false
+	}
+	for i, name := range keys {
+		event, ok := parseKeyName(name)
+		if !ok {
+			return "", false
+		}
+		keys[i] = event.String()
+	}
+	return strings.Join(keys, " "), true
+}
+
+// Event for a single byte that is not part of a sequence
+func controlKey(input byte) keyEvent {
+	switch input {
+	case '\n', '\r':
+		return keyEvent{key: "Enter"}
+	case '\t':
+		return keyEvent{key: "Tab"}
+	case 0x7F:
+		return keyEvent{key: "Backspace"}
+	case 0x1B:
+		return keyEvent{key: "Esc"}
+	case 0x00:
+		return keyEvent{key: "Space", mod: modCtrl}
+	}
+	r := rune(input) + 0x40 // C-a is 0x01, C-_ is 0x1f
+	r = unicode.ToLower(r)
+	return keyEvent{key: string(r), r: r, mod: modCtrl}
+}
+
+// Is the decoder in the middle of a sequence or character. A paste is never
+// pending, it always ends with PASTE_END.
+func (dec *keyDecoder) pending() bool {
+	return (dec.state != decodeGround && dec.state != decodePaste) || dec.alt
+}
+
+func (dec *keyDecoder) reset() {
+	dec.state = decodeGround
+	dec.buf = dec.buf[:0]
+	dec.alt = false
+}
+
+// Give up waiting for the rest of a sequence. A lone ESC becomes the Esc key,
+// ESC [ and ESC O become Alt + [ and Alt + O, anything else is dropped.
+func (dec *keyDecoder) flush() []keyEvent {
+	var events []keyEvent
+	switch {
+	case dec.state == decodeEscape && dec.alt:
+		events = append(events, keyEvent{key: "Esc", mod: modAlt})
+	case dec.state == decodeEscape:
+		events = append(events, keyEvent{key: "Esc"})
+	case dec.state == decodeCSI && len(dec.buf) == 0:
+		events = append(events, keyEvent{key: "[", r: '[', mod: modAlt})
+	case dec.state == decodeSS3 && len(dec.buf) == 0:
+		events = append(events, keyEvent{key: "O", r: 'O', mod: modAlt})
+	case dec.state == decodePaste:
+		events = append(events, dec.pasteEvent(dec.buf))
+	}
+	dec.reset()
+	return events
+}
+
+// Feed one byte of input, returns the keys it completed
+func (dec *keyDecoder) feed(input byte) []keyEvent {
+	var events []keyEvent
+	for {
+		event, done, consumed := dec.step(input)
+		if done {
+			if dec.alt {
+				event.mod |= modAlt
+			}
+			dec.reset()
+			events = append(events, event)
+		}
+		if consumed {
+			return events
+		}
+	}
+}
+
+// Advance the state machine by one byte. done is true when a key is
+// complete, consumed is false when the byte ended a sequence without being
+// part of it and has to be fed again.
+func (dec *keyDecoder) step(input byte) (event keyEvent, done bool, consumed bool) {
+	switch dec.state {
+	case decodeGround:
+		switch {
+		case input == 0x1B:
+			dec.state = decodeEscape
+		case input >= utf8.RuneSelf:
+			dec.state = decodeUTF8
+			dec.buf = append(dec.buf, input)
+		case input < 0x20 || input == 0x7F:
+			return controlKey(input), true, true
+		default:
+			return dec.charEvent(rune(input)), true, true
+		}
+		return event, false, true
+
+	case decodeUTF8:
+		if input&0xC0 != 0x80 {
+			// Not a continuation byte, drop the broken character
+			dec.reset()
+			return event, false, false
+		}
+		dec.buf = append(dec.buf, input)
+		if !utf8.FullRune(dec.buf) {
+			return event, false, true
+		}
+		r, _ := utf8.DecodeRune(dec.buf)
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			dec.reset()
+			return event, false, true
+		}
+		return dec.charEvent(r), true, true
+
+	case decodeEscape:
+		switch input {
+		case '[':
+			dec.state = decodeCSI
+		case 'O':
+			dec.state = decodeSS3
+		case 0x1B:
+			if dec.alt {
+				// Third ESC in a row
+				return keyEvent{key: "Esc"}, true, false
+			}
+			dec.alt = true
+		default:
+			// Alt + key, decode the key on its own
+			dec.state = decodeGround
+			dec.alt = true
+			return event, false, false
+		}
+		return event, false, true
+
+	case decodeCSI:
+		switch {
+		case len(dec.buf) == 0 && input == '[':
+			dec.state = decodeLinuxFn
+		case input == '~' && ESCSEQ+string(dec.buf)+"~" == PASTE_START:
+			dec.state = decodePaste
+			dec.buf = dec.buf[:0]
+		case input >= 0x40 && input <= 0x7E,
+			input == '$' && len(dec.buf) > 0: // rxvt Shift + key
+			event, ok := parseCSI(string(dec.buf), input)
+			if !ok {
+				dec.reset()
+				return event, false, true
+			}
+			return event, true, true
+		case input >= 0x20 && input < 0x40 && len(dec.buf) < maxSequenceLength:
+			dec.buf = append(dec.buf, input)
+		case input >= 0x20 && input < 0x40:
+			// Too long to be a key, skip the rest of it
+			dec.state = decodeDiscard
+		default:
+			// Control character or garbage inside the sequence
+			dec.reset()
+			return event, false, false
+		}
+		return event, false, true
+
+	case decodeSS3:
+		switch {
+		case input >= '0' && input <= '9' && len(dec.buf) < maxSequenceLength:
+			dec.buf = append(dec.buf, input)
+			return event, false, true
+		case input >= 0x40 && input <= 0x7E:
+			event, ok := parseSS3(string(dec.buf), input)
+			if !ok {
+				dec.reset()
+				return event, false, true
+			}
+			return event, true, true
+		}
+		dec.reset()
+		return event, false, false
+
+	case decodePaste:
+		dec.buf = append(dec.buf, input)
+		if bytes.HasSuffix(dec.buf, []byte(PASTE_END)) {
+			return dec.pasteEvent(dec.buf[:len(dec.buf)-len(PASTE_END)]), true, true
+		}
+		return event, false, true
+
+	case decodeDiscard:
+		if input >= 0x20 && input < 0x40 {
+			return event, false, true
+		}
+		dec.reset()
+		return event, false, input >= 0x40 && input <= 0x7E
+
+	case decodeLinuxFn:
+		// ESC [ [ A to ESC [ [ E are F1 to F5
+		if input >= 'A' && input <= 'E' {
+			return keyEvent{key: "F" + string(rune(input-'A'+'1'))}, true, true
+		}
+		dec.reset()
+		return event, false, true
+	}
+	return event, false, true
+}
+
+// Event for a typed character
+func (dec *keyDecoder) charEvent(r rune) keyEvent {
+	if dec.raw {
+		return keyEvent{r: r}
+	}
+	return keyEvent{key: string(r), r: r}
+}
+
+// Event for pasted text. Line endings become newlines and other control
+// characters, apart from tabs, are dropped.
+func (dec *keyDecoder) pasteEvent(pasted []byte) keyEvent {
+	if dec.raw {
+		return keyEvent{key: "Paste", data: pasted}
+	}
+	text := strings.Replace(string(pasted), "\r\n", "\n", -1)
+	text = strings.Replace(text, "\r", "\n", -1)
+	text = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n' && r != '\t') {
+			return -1
+		}
+		return r
+	}, text)
+	return keyEvent{key: "Paste", text: text}
+}
+
+// Decode the xterm modifier parameter, 1 + a bit mask of the modifiers
+func decodeModifier(param string) keyModifier {
+	value, err := strconv.Atoi(param)
+	if err != nil || value < 2 {
+		return 0
+	}
+	value -= 1
+	var mod keyModifier
+	if value&1 != 0 {
+		mod |= modShift
+	}
+	if value&(2|8) != 0 { // Alt or Meta
+		mod |= modAlt
+	}
+	if value&4 != 0 {
+		mod |= modCtrl
+	}
+	return mod
+}
+
+// Key for a character code sent by CSI u and modifyOtherKeys sequences
+func codepointKey(param string, mod keyModifier) (keyEvent, bool) {
+	code, err := strconv.Atoi(param)
+	if err != nil || code <= 0 || code > unicode.MaxRune {
+		return keyEvent{}, false
+	}
+	if code < 0x20 || code == 0x7F {
+		event := controlKey(byte(code))
+		event.mod |= mod
+		return event, true
+	}
+	r := rune(code)
+	return keyEvent{key: string(r), r: r, mod: mod}, true
+}
+
+// Decode a CSI sequence from its parameter bytes and final byte
+func parseCSI(params string, final byte) (keyEvent, bool) {
+	args := strings.Split(params, ";")
+	mod := keyModifier(0)
+	if len(args) > 1 {
+		mod = decodeModifier(args[1])
+	}
+
+	switch final {
+	case '~', '^', '$', '@':
+		// rxvt marks modifiers with the final byte
+		switch final {
+		case '^':
+			mod |= modCtrl
+		case '$':
+			mod |= modShift
+		case '@':
+			mod |= modCtrl | modShift
+		}
+		code, _ := strconv.Atoi(args[0])
+		if code == 27 && len(args) == 3 { // xterm modifyOtherKeys
+			return codepointKey(args[2], mod)
+		}
+		if name, ok := tildeKeys[code]; ok {
+			return keyEvent{key: name, mod: mod}, true
+		}
+	case 'u':
+		return codepointKey(args[0], mod)
+	case 'Z':
+		return keyEvent{key: "Tab", mod: modShift}, true
+	case 'a', 'b', 'c', 'd':
+		// rxvt Shift + arrow
+		return keyEvent{key: csiKeys[final-'a'+'A'], mod: modShift}, true
+	default:
+		if name, ok := csiKeys[final]; ok {
+			return keyEvent{key: name, mod: mod}, true
+		}
+	}
+	return keyEvent{}, false
+}
+
+// Decode an SS3 sequence. Some terminals put a modifier parameter between
+// ESC O and the final byte.
+func parseSS3(params string, final byte) (keyEvent, bool) {
+	mod := decodeModifier(params)
+	switch {
+	case final >= 'a' && final <= 'd':
+		// rxvt Ctrl + arrow
+		return keyEvent{key: csiKeys[final-'a'+'A'], mod: mod | modCtrl}, true
+	case final == 'X':
+		return keyEvent{key: "=", r: '=', mod: mod}, true
+	case final >= 'j' && final <= 'y':
+		// Keypad in application mode
+		r := rune("*+,-./0123456789"[final-'j'])
+		return keyEvent{key: string(r), r: r, mod: mod}, true
+	}
+	if name, ok := ss3Keys[final]; ok {
+		return keyEvent{key: name, mod: mod}, true
+	}
+	return keyEvent{}, false
+}
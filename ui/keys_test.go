@@ -0,0 +1,164 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+// Decode input, flushing at the end, and return the key names
+func decodeKeys(input string) string {
+	var dec keyDecoder
+	var events []keyEvent
+	for i := 0; i < len(input); i++ {
+		events = append(events, dec.feed(input[i])...)
+	}
+	events = append(events, dec.flush()...)
+
+	names := make([]string, 0, len(events))
+	for _, event := range events {
+		names = append(names, event.String())
+	}
+	return strings.Join(names, " ")
+}
+
+func TestKeyDecoder(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		// Characters and control keys
+		{"ab", "a b"},
+		{"é日", "é 日"},
+		{"\x01\x05\x1f\x00", "C-a C-e C-_ C-Space"},
+		{"\r\n\t\x7f\x08", "Enter Enter Tab Backspace C-h"},
+		{"\xff\xfea", "a"},
+		{"\xc3a", "a"},
+
+		// Alt + key
+		{"\x1bb", "M-b"},
+		{"\x1b\x7f", "M-Backspace"},
+		{"\x1b\x01", "C-M-a"},
+		{"\x1bé", "M-é"},
+
+		// Lone and repeated ESC
+		{"\x1b", "Esc"},
+		{"\x1b\x1b", "M-Esc"},
+		{"\x1b\x1b\x1b", "M-Esc Esc"},
+		{"\x1b[", "M-["},
+		{"\x1bO", "M-O"},
+
+		// xterm, tmux and screen
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", "Up Down Right Left"},
+		{"\x1b[H\x1b[F", "Home End"},
+		{"\x1b[1~\x1b[2~\x1b[3~\x1b[4~", "Home Insert Delete End"},
+		{"\x1b[5~\x1b[6~", "PageUp PageDown"},
+		{"\x1b[1;5C\x1b[1;5D", "C-Right C-Left"},
+		{"\x1b[1;3A\x1b[1;2B\x1b[1;7H", "M-Up S-Down C-M-Home"},
+		{"\x1b[3;5~", "C-Delete"},
+		{"\x1b[Z", "S-Tab"},
+		{"\x1b[15~\x1b[24~\x1b[1;2P", "F5 F12 S-F1"},
+		{"\x1b\x1b[A", "M-Up"},
+
+		// SS3 (application cursor keys)
+		{"\x1bOA\x1bOD\x1bOH\x1bOF", "Up Left Home End"},
+		{"\x1bOP\x1bOS\x1bOM", "F1 F4 Enter"},
+		{"\x1bO5C", "C-Right"},
+
+		// rxvt
+		{"\x1b[7~\x1b[8~", "Home End"},
+		{"\x1bOc\x1b[a", "C-Right S-Up"},
+		{"\x1b[3^\x1b[3$\x1b[3@", "C-Delete S-Delete C-S-Delete"},
+
+		// Linux console
+		{"\x1b[[A\x1b[[E", "F1 F5"},
+
+		// CSI u and modifyOtherKeys
+		{"\x1b[97;5u\x1b[13;2u", "C-a S-Enter"},
+		{"\x1b[27;5;105~", "C-i"},
+
+		// Unknown and broken sequences never get stuck
+		{"\x1b[99~a", "a"},
+		{"\x1b[201~x", "x"},
+		{"\x1b[1;5\x01", "C-a"},
+		{"\x1b[1;5\x1b[A", "Up"},
+		{"\x1b[" + strings.Repeat("1", 40) + "Ab", "b"},
+		{"\x1b[1", ""},
+	}
+
+	for _, c := range cases {
+		got := decodeKeys(c.input)
+		if got != c.expected {
+			t.Errorf("decode(%q) == %q, want %q", c.input, got, c.expected)
+		}
+	}
+}
+
+func TestPasteDecoding(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+		after    string
+	}{
+		{PASTE_START + "ls -l" + PASTE_END, "ls -l", ""},
+		{PASTE_START + "a\x1b[Ab\x01c\td" + PASTE_END + "x", "a[Abc\td", "x"},
+		{PASTE_START + "one\r\ntwo\rthree\n" + PASTE_END, "one\ntwo\nthree\n", ""},
+		{PASTE_START + "日本\xff" + PASTE_END, "日本", ""},
+		{PASTE_START + PASTE_END + "\x1b[A", "", "Up"},
+	}
+
+	for _, c := range cases {
+		var dec keyDecoder
+		var events []keyEvent
+		for i := 0; i < len(c.input); i++ {
+			events = append(events, dec.feed(c.input[i])...)
+		}
+		events = append(events, dec.flush()...)
+
+		if len(events) == 0 || events[0].key != "Paste" || events[0].text != c.expected {
+			t.Errorf("decode(%q) == %v, want paste of %q", c.input, events, c.expected)
+			continue
+		}
+		after := make([]string, 0, len(events))
+		for _, event := range events[1:] {
+			after = append(after, event.String())
+		}
+		if strings.Join(after, " ") != c.after {
+			t.Errorf("decode(%q) keys after paste == %v, want %q", c.input, after, c.after)
+		}
+	}
+
+	// Pasted escape characters never wait for the escape timeout
+	var dec keyDecoder
+	for _, input := range []byte(PASTE_START + "a\x1b") {
+		dec.feed(input)
+	}
+	if dec.pending() {
+		t.Errorf("decoder pending inside a paste")
+	}
+}
+
+func TestParseKeyName(t *testing.T) {
+	cases := []struct {
+		name      string
+		canonical string
+		ok        bool
+	}{
+		{"C-a", "C-a", true},
+		{"M-C-a", "C-M-a", true},
+		{"S-Tab", "S-Tab", true},
+		{"C-Right", "C-Right", true},
+		{"F12", "F12", true},
+		{"M-é", "M-é", true},
+		{"C-xx", "", false},
+		{"Foo", "", false},
+		{"X-a", "", false},
+	}
+
+	for _, c := range cases {
+		event, ok := parseKeyName(c.name)
+		if ok != c.ok || (ok && event.String() != c.canonical) {
+			t.Errorf("parseKeyName(%q) == %q, %v, want %q, %v",
+				c.name, event.String(), ok, c.canonical, c.ok)
+		}
+	}
+}
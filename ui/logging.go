@@ -8,14 +8,21 @@ var (
 	DEBUG = true
 )
 
+// Messages go through the default console, so they are drawn above the line
+// being edited rather than in it
 func warning(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf(colorize("[!]", "yellow", "black")+format, args...))
+	defaultConsole.warning(format, args...)
 }
 func info(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf(colorize("[I]", "blue", "black")+format, args...))
+	defaultConsole.Notify(fmt.Sprintf(colorize("[I]", "blue", "black")+format, args...))
 }
 func debug(format string, args ...interface{}) {
 	if DEBUG {
-		fmt.Println(fmt.Sprintf(colorize("[D]", "green", "black")+format, args...))
+		defaultConsole.Notify(fmt.Sprintf(colorize("[D]", "green", "black")+format, args...))
 	}
 }
+
+// Warn about something on this console, such as its history file
+func (console *Console) warning(format string, args ...interface{}) {
+	console.Notify(fmt.Sprintf(colorize("[!]", "yellow", "black")+format, args...))
+}
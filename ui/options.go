@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type option struct {
+	name        string
+	description string
+	value       string
+	onSet       func(value string) error
+}
+
+var (
+	options = make(map[string]*option)
+)
+
+// Register a global option with its default value. onSet is called whenever
+// the option changes and can reject the new value by returning an error.
+func RegisterOption(name string, description string, value string,
+	onSet func(string) error) {
+
+	options[name] = &option{name, description, value, onSet}
+}
+
+// Register an option that is on or off, setting *enabled. Its default is
+// what *enabled holds.
+func RegisterBoolOption(name string, description string, enabled *bool) {
+	value := "off"
+	if *enabled {
+		value = "on"
+	}
+	RegisterOption(name, description, value, func(value string) error {
+		switch value {
+		case "on":
+			*enabled = true
+		case "off":
+			*enabled = false
+		default:
+			return errors.New(fmt.Sprintf("Invalid value '%v', use on or off", value))
+		}
+		return nil
+	})
+}
+
+// Change the value of a registered option
+func SetOption(name string, value string) error {
+	opt, ok := options[name]
+	if !ok {
+		return errors.New(fmt.Sprintf("Option '%v' not found. Try 'showOptions'", name))
+	}
+	if opt.onSet != nil {
+		if err := opt.onSet(value); err != nil {
+			return err
+		}
+	}
+	opt.value = value
+	return nil
+}
+
+// Current value of an option, empty if it is not registered
+func GetOption(name string) string {
+	if opt, ok := options[name]; ok {
+		return opt.value
+	}
+	return ""
+}
+
+// Complete option names, with their descriptions
+func setTabComplete(input string, cursor int) []Candidate {
+	if strings.Contains(string([]rune(input)[:cursor]), " ") {
+		return nil
+	}
+	names := make([]string, 0, len(options))
+	descriptions := make(map[string]string, len(options))
+	for name, opt := range options {
+		names = append(names, name)
+		descriptions[name] = opt.description
+	}
+	sort.Strings(names)
+	return completeWords(input, cursor, names, descriptions)
+}
+
+func setOption(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) < 2 {
+		return "", errors.New("Usage: set <Option name> <Value>")
+	}
+	value := strings.Join(args[1:], " ")
+	if err := SetOption(args[0], value); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v => %v", args[0], value), nil
+}
+
+func showOptions(command string) (string, error) {
+	names := make([]string, 0, len(options))
+	for name, _ := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	output := "Options:"
+	for _, name := range names {
+		opt := options[name]
+		output += fmt.Sprintf("\n\t%v = %v - %v", name, opt.value, opt.description)
+	}
+	return output, nil
+}
@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"testing"
+)
+
+func TestRegisterBoolOption(t *testing.T) {
+	defer delete(options, "test")
+	enabled := true
+	RegisterBoolOption("test", "", &enabled)
+	if got := GetOption("test"); got != "on" {
+		t.Errorf("default of an enabled option = %q, want %q", got, "on")
+	}
+
+	cases := []struct {
+		value    string
+		expected bool
+		isError  bool
+	}{
+		{"off", false, false},
+		{"on", true, false},
+		{"yes", true, true},
+		{"off", false, false},
+		{"", false, true},
+	}
+	for _, c := range cases {
+		err := SetOption("test", c.value)
+		if enabled != c.expected || (err != nil) != c.isError {
+			t.Errorf("SetOption(%q) = %v leaving %v, want error %v leaving %v", c.value,
+				err, enabled, c.isError, c.expected)
+		}
+	}
+}
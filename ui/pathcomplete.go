@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+	Completion of file names and of programs on $PATH. CompletePath can be
+	registered as the tabComplete of any command that takes file arguments.
+*/
+
+// Complete the word under the cursor as a path. A leading ~ stands for the
+// home directory and is kept, special characters in names are escaped with a
+// backslash. Directories get a trailing / so completion can carry on into
+// them.
+func CompletePath(input string, cursor int) []Candidate {
+	runes := []rune(input)
+	start := shellWordStart(runes, cursor)
+	word := unquoteWord(string(runes[start:cursor]))
+	if word == "~" {
+		return []Candidate{{Text: "~/", Start: start, End: cursor}}
+	}
+
+	dir := word[:strings.LastIndex(word, "/")+1]
+	base := word[len(dir):]
+	readDir := expandHome(dir)
+	if dir == "" {
+		readDir = "."
+	}
+	entries, err := ioutil.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	candidates := make([]Candidate, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (name[0] == '.' && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		text := quoteWord(dir+name) + " "
+		display := name
+		if isDir(filepath.Join(readDir, name), entry) {
+			text = quoteWord(dir+name) + "/"
+			display += "/"
+		}
+		candidates = append(candidates, Candidate{text, display, "", start, cursor})
+	}
+	return candidates
+}
+
+// Is the file a directory, or a link to one
+func isDir(path string, info os.FileInfo) bool {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		return err == nil && target.IsDir()
+	}
+	return info.IsDir()
+}
+
+// Names of the programs on $PATH that start with prefix, sorted
+func findExecutables(prefix string) []string {
+	found := make(map[string]bool)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, prefix) || found[name] ||
+				isDir(filepath.Join(dir, name), entry) {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil &&
+				info.Mode()&0111 != 0 {
+				found[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name, _ := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,111 @@
+package ui
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompletePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"My File.txt", "mydir/", "mydir/inner", ".hidden", "other"} {
+		path := filepath.Join(dir, name)
+		if name[len(name)-1] == '/' {
+			err = os.Mkdir(path, 0755)
+		} else {
+			err = ioutil.WriteFile(path, nil, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink(filepath.Join(dir, "mydir"), filepath.Join(dir, "link"))
+
+	defer func(home string) { os.Setenv("HOME", home) }(os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+
+	cases := []struct {
+		input    string
+		expected []string
+		display  []string
+	}{
+		{"cat " + dir + "/M", []string{dir + `/My\ File.txt `}, []string{"My File.txt"}},
+		{"cat " + dir + "/my", []string{dir + "/mydir/"}, []string{"mydir/"}},
+		{"cat " + dir + "/mydir/", []string{dir + "/mydir/inner "}, []string{"inner"}},
+		{"cat " + dir + "/l", []string{dir + "/link/"}, []string{"link/"}},
+		{"cat " + dir + "/.h", []string{dir + "/.hidden "}, []string{".hidden"}},
+		{"cat " + dir + "/x", []string{}, []string{}},
+		{"cat " + dir + "/nodir/", nil, nil},
+		{`cat "` + dir + `/My F`, []string{dir + `/My\ File.txt `}, []string{"My File.txt"}},
+		{"cat ~", []string{"~/"}, []string{"~/"}},
+		{"cat ~/o", []string{"~/other "}, []string{"other"}},
+		{"cat ~/", []string{`~/My\ File.txt `, "~/link/", "~/mydir/", "~/other "},
+			[]string{"My File.txt", "link/", "mydir/", "other"}},
+	}
+
+	for _, c := range cases {
+		cursor := len([]rune(c.input))
+		candidates := CompletePath(c.input, cursor)
+		var texts, displays []string
+		if candidates != nil {
+			texts = make([]string, 0, len(candidates))
+			displays = make([]string, 0, len(candidates))
+		}
+		for _, candidate := range candidates {
+			texts = append(texts, candidate.Text)
+			displays = append(displays, candidate.display())
+			if candidate.Start != 4 || candidate.End != cursor {
+				t.Errorf("CompletePath(%q) %q spans %v-%v, want 4-%v",
+					c.input, candidate.Text, candidate.Start, candidate.End, cursor)
+			}
+		}
+		if !reflect.DeepEqual(texts, c.expected) || !reflect.DeepEqual(displays, c.display) {
+			t.Errorf("CompletePath(%q) = %q %q, want %q %q",
+				c.input, texts, displays, c.expected, c.display)
+		}
+	}
+}
+
+func TestTabCompleteFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "gobar-test-tool"), nil, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "gobar-test-data"), nil, 0644)
+	os.Mkdir(filepath.Join(dir, "gobar-test-dir"), 0755)
+
+	defer func(path string) { os.Setenv("PATH", path) }(os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+	defer func(saved map[string]command) { commands = saved }(commands)
+	commands = make(map[string]command)
+	RegisterCommand("gobar-test-command", "", "", help, NilTabComplete)
+
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{"gobar-test", []string{"gobar-test-command "}},
+		{"gobar-test-t", []string{"gobar-test-tool "}},
+		{"gobar-test-tool " + dir + "/gobar-test-d", []string{
+			dir + "/gobar-test-data ", dir + "/gobar-test-dir/"}},
+		{"gobar-test-command " + dir + "/gobar", []string{}},
+	}
+
+	for _, c := range cases {
+		texts := []string{}
+		for _, candidate := range TabComplete(c.input, len(c.input)) {
+			texts = append(texts, candidate.Text)
+		}
+		if !reflect.DeepEqual(texts, c.expected) {
+			t.Errorf("TabComplete(%q) = %q, want %q", c.input, texts, c.expected)
+		}
+	}
+}
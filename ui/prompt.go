@@ -2,40 +2,86 @@ package ui
 
 import (
 	"flag"
-	"fmt"
-	"github.com/fatih/color"
-	"os"
-	"os/exec"
+	"github.com/mattn/go-runewidth"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 /*
-	Holds each segment on the CLI, e.g. [ 10.12.90.12 ][ gobar ]
+Holds each segment on the CLI, e.g. [ 10.12.90.12 ][ gobar ]
+Text is shown as it is, unless the segment has a provider for its text.
+The colours are those of the Style in the current theme, Fgcolor and
+Bgcolor are used if it has no Style or the theme does not have it.
 */
 type PromptSegment struct {
-	Text    string
-	Fgcolor string
-	Bgcolor string
+	Text     string
+	Fgcolor  string
+	Bgcolor  string
+	Style    string
+	provider *segmentProvider
 }
 
 /*
 	Internal representation for the current state of the command line.
-	input: 		Holds user input (printable characters)
-	escape: 	the current escape sequence
-	cursor: 	Index of the current cursor
-	tabCont: 	How many times we've hit Tab (mod 2)
+	input: 		Holds user input (printable characters, UTF-8)
+	keys: 		Decodes input bytes into key events
+	cursor: 	Index of the current cursor, in runes
+	search: 	Reverse history search in progress, nil when not searching
+	vi: 		vi mode state, nil in emacs mode
+	complete: 	Tab completion function
+	menu: 		Completion menu being shown, nil if none
+	lastAction:	Name of the last editing action
+	keyPrefix: 	Keys typed so far of a key sequence
+	undoStack: 	States to go back to with undo, oldest first
+	redoStack: 	States undone, to go forward to with redo
+	suggestion:	Suggested rest of the line, shown after the input
+	killedAt: 	Cursor position after the last kill
+	yankIndex: 	Kill ring entry that was yanked last
+	yankLength:	Length of the text yanked last
+	clear: 		The screen should be cleared before the line is drawn
+	cancelled: 	The line was discarded, a new one should be started
+	done: 		The line is complete
+	eof: 		The user signalled the end of input
+	shared: 	History, kill ring and keymap of the console, see editor()
+	kinds: 		What the command words typed on the line run, see commandKind.
+			Only used while drawing, with the console mutex held
 
 */
 
 type commandLine struct {
-	input    string
-	escape   string
-	cursor   int
-	tabCount int
-}
-
+	input  string
+	keys   keyDecoder
+	cursor int
+	search *historySearch
+	vi     *viState
+
+	complete   Completer
+	menu       *completionMenu
+	lastAction string
+	keyPrefix  string
+	undoStack  []lineState
+	redoStack  []lineState
+	suggestion string
+	killedAt   int
+	yankIndex  int
+	yankLength int
+	clear      bool
+	cancelled  bool
+	done       bool
+	eof        bool
+	shared     *editorState
+	kinds      map[string]string
+}
+
+// Commands entered, oldest first
+//
+//	commandHistory: The commands
+//	times:          When each command was last entered
+//	index:          Item being recalled, one past the end when none is
 type history struct {
 	commandHistory []string
+	times          []time.Time
 	index          int
 }
 
@@ -53,334 +99,544 @@ const (
 	LEFT  = ESCSEQ + "\x44"
 	EOT   = "\x04"
 
-	PRINTABLE = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890~`!@#$%^&*()_-+='\"{}[]\\|:;<>,. /?"
+	PASTE_ON    = ESCSEQ + "?2004h" // Enable bracketed paste
+	PASTE_OFF   = ESCSEQ + "?2004l"
+	PASTE_START = ESCSEQ + "200~"
+	PASTE_END   = ESCSEQ + "201~"
 
-	historySize = 100
+	historySize = 1000
 )
 
 var (
-	ALLESC = [...]string{HOME, INSERT, DELETE, END, UP, DOWN, LEFT, RIGHT}
-
 	// Possible prompt options ⌲  ▶  ⌦ ⫸     
-	prompt_end = flag.String("prompt_end", "", "Prompt character")
-	prompt_mid = flag.String("prompt_mid", " ", "Prompt character")
-
-	yellow = color.New(color.FgYellow).SprintFunc()
-	red    = color.New(color.FgRed).SprintFunc()
-	green  = color.New(color.FgGreen).SprintFunc()
-	blue   = color.New(color.FgBlue).SprintFunc()
-	black  = color.New(color.FgBlack).SprintFunc()
-	white  = color.New(color.FgWhite).SprintFunc()
-
-	bgred     = color.New(color.BgRed).SprintFunc()
-	bggreen   = color.New(color.BgGreen).SprintFunc()
-	bgyellow  = color.New(color.BgYellow).SprintFunc()
-	bgblue    = color.New(color.BgBlue).SprintFunc()
-	bgmagenta = color.New(color.BgMagenta).SprintFunc()
-	bgcyan    = color.New(color.BgCyan).SprintFunc()
-	bgblack   = color.New(color.BgBlack).SprintFunc()
-	bgwhite   = color.New(color.BgWhite).SprintFunc()
-
-	prepared       = false
-	commandHistory = newHistory(historySize)
-	historyIndex   = 0
-
-	override_colors = false
-	override_fg     = ""
-	override_bg     = ""
+	prompt_end = flag.String("prompt_end", "", "Prompt character, instead of the theme's")
+	prompt_mid = flag.String("prompt_mid", "", "Separator between prompt segments, instead of the theme's")
 )
 
 // Exported Functions
 func NewPromptSegment(text, fgcolor, bgcolor string) PromptSegment {
-	return PromptSegment{text, fgcolor, bgcolor}
+	checkSegmentColors(fgcolor, bgcolor)
+	return PromptSegment{Text: text, Fgcolor: fgcolor, Bgcolor: bgcolor}
 }
 
-func DisplayPrompt(segments []PromptSegment) {
-	for i, segment := range segments {
-		fmt.Print(renderSegment(segment, i+1 == len(segments)))
-	}
-	color.Unset()
-	fmt.Print(" ")
+// Create a segment drawn in a style of the theme
+func NewStyledSegment(text, style string) PromptSegment {
+	return PromptSegment{Text: text, Style: style}
 }
 
-func GetUserInput(segments []PromptSegment, tabComplete func(string, int) string) string {
-	if !prepared {
-		prepareKeyboard()
+func (console *Console) DisplayPrompt(segments []PromptSegment) {
+	console.write(renderPrompt(segments, ""))
+}
+
+func (console *Console) GetUserInput(segments []PromptSegment, tabComplete Completer) string {
+	if !console.state.historyRead {
+		if err := console.state.loadHistory(); err != nil {
+			console.warning("Unable to load history: %v", err)
+		}
+		console.state.historyRead = true
+	}
+	if console.isPlain() {
+		handleSignals()
+		return strings.TrimSpace(console.getPlainInput(segments))
 	}
-	DisplayPrompt(segments)
+	// Commands run with the terminal as it was, so they can read from it and
+	// Ctrl+C interrupts them
+	console.prepareKeyboard()
+	defer console.resetKeyboard()
 	//reader := bufio.NewReader(os.Stdin)
 	//text, _ := reader.ReadString('\n')
-	text := getInput(segments, tabComplete)
+	console.enablePaste()
+	text := console.getInput(segments, tabComplete)
+	console.disablePaste()
 	text = strings.TrimSpace(text)
 	return text
 }
 
-func Exit() {
-	fmt.Println("") // newline to not mess up terminal
-	resetKeyboard()
+func (console *Console) Exit() {
+	console.write("\n") // newline to not mess up terminal
+	console.resetKeyboard()
 }
 
-func Error(message string, uiSegments []PromptSegment) {
-	override_colors = true
-	override_fg = "black"
-	override_bg = "red"
-	DisplayPrompt(uiSegments)
-	override_colors = false
+func (console *Console) Error(message string, uiSegments []PromptSegment) {
+	console.write(renderPrompt(uiSegments, "error") + message + "\n")
+}
 
-	fmt.Println(message)
+func (console *Console) Output(message string, uiSegments []PromptSegment) {
+	console.write(renderPrompt(uiSegments, "output") + message + "\n")
 }
 
-func Output(message string, uiSegments []PromptSegment) {
-	override_fg = "white"
-	override_bg = "black"
-	override_colors = true
-	DisplayPrompt(uiSegments)
-	fmt.Println(message)
-	override_colors = false
+// Print a message above the line being edited, then draw the line again
+// with the cursor where it was. While no line is edited the message is just
+// printed. Safe to call from any goroutine.
+func (console *Console) Notify(message string) {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	if console.editing == nil {
+		console.print(message + "\n")
+		return
+	}
+	console.clearLine()
+	console.print(message + "\r\n")
+	console.drawLine(*console.editing, console.prompts)
 }
 
 // Color functions
 
-func (segment *PromptSegment) String() string {
-	return segment.Text + " fg: " + segment.Fgcolor + " bg: " + segment.Bgcolor
+// Warn about colours that can't be shown, they would be left out
+func checkSegmentColors(fgcolor, bgcolor string) {
+	for _, style := range []string{fgcolor, bgcolor} {
+		if err := CheckColor(style); err != nil {
+			warning("%v", err)
+		}
+	}
 }
 
-func colorize(text string, fg string, bg string) string {
-	var colorized string = text
-	switch fg {
-	case "white":
-		colorized = white(text)
-	case "red":
-		colorized = red(text)
-	case "green":
-		colorized = green(text)
-	case "black":
-		colorized = black(text)
-	case "blue":
-		colorized = blue(text)
-	}
-
-	switch bg {
-	case "white":
-		colorized = bgwhite(colorized)
-	case "red":
-		colorized = bgred(colorized)
-	case "green":
-		colorized = bggreen(colorized)
-	case "black":
-		colorized = bgblack(colorized)
-	case "blue":
-		colorized = bgblue(colorized)
-	case "yellow":
-		colorized = bgyellow(colorized)
-	case "magenta":
-		colorized = bgmagenta(colorized)
-	case "cyan":
-		colorized = bgcyan(colorized)
-	}
-	return colorized
+func (segment *PromptSegment) String() string {
+	return segment.Text + " fg: " + segment.Fgcolor + " bg: " + segment.Bgcolor
 }
 
 // Render and display functions
 
-func renderSegment(segment PromptSegment, end bool) string {
+// The prompt as it is displayed, segments with no text are left out. All
+// segments are drawn in the theme's style if one is given.
+func renderPrompt(segments []PromptSegment, style string) string {
+	shown := make([]PromptSegment, 0, len(segments))
+	for _, segment := range resolveSegments(segments) {
+		if segment.Text != "" {
+			shown = append(shown, segment)
+		}
+	}
+	rendered := ""
+	for i, segment := range shown {
+		rendered += renderSegment(segment, i+1 == len(shown), style)
+	}
+	return rendered + " "
+}
+
+func renderSegment(segment PromptSegment, end bool, style string) string {
 	text := segment.Text
 	fg := segment.Fgcolor
 	bg := segment.Bgcolor
-	if override_colors {
-		fg = override_fg
-		bg = override_bg
+	if themeFg, themeBg, ok := themeStyle(segment.Style); ok {
+		fg, bg = themeFg, themeBg
+	}
+	if style != "" {
+		fg, bg, _ = themeStyle(style)
 	}
+	endSeparator, midSeparator := themeSeparators()
 	if end {
+		// The end separator continues the segment's background into the
+		// terminal's, or is just in the text colour if it has none
+		separatorColor := bg
+		if separatorColor == "" {
+			separatorColor = fg
+		}
 		text = colorize(text+" ", fg, bg)
-		text += colorize(*prompt_end, bg, fg)
+		text += colorize(endSeparator, separatorColor, "")
 	} else {
-		text = colorize(text+*prompt_mid, fg, bg)
+		text = colorize(text+midSeparator, fg, bg)
 	}
 	return text
 }
 
-func drawLine(line commandLine, prompts []PromptSegment) {
-	DisplayPrompt(prompts)
-	fmt.Print(line.input)
-	if line.cursor < len(line.input) {
-		fmt.Printf(ESCSEQ+"%vD", len(line.input)-line.cursor)
+func (console *Console) drawLine(line commandLine, prompts []PromptSegment) {
+	console.drawInput(line, prompts)
+	if line.menu == nil {
+		return
+	}
+	// Draw the menu below the line, then go back up and draw the line again
+	// to put the cursor where it belongs
+	rows := line.menu.render(console.width())
+	console.moveBelowLine()
+	console.print("\r\n" + strings.Join(rows, "\r\n"))
+	console.printf(ESCSEQ+"%vA\r", len(rows)+console.rows-1)
+	console.drawInput(line, prompts)
+}
+
+// Draw the prompt and the input, leaving the cursor in the input. Input too
+// wide for the terminal wraps onto more rows.
+func (console *Console) drawInput(line commandLine, prompts []PromptSegment) {
+	var shown string
+	if line.search != nil {
+		shown = searchPrompt(line)
+	} else {
+		if line.vi != nil {
+			prompts = append([]PromptSegment{line.viSegment()}, prompts...)
+		}
+		prompt := renderPrompt(prompts, "")
+		used := visibleWidth(prompt) + displayWidth(renderInput(line.input+line.suggestion))
+		console.drawRightPrompt(used)
+		shown = prompt + highlightInput(line.input, line.kinds)
+	}
+	if line.suggestion != "" {
+		shown += dim(renderInput(line.suggestion))
+	}
+	console.print(shown)
+
+	// Whatever is displayed after the cursor ends the shown text
+	plain := []rune(stripEscapes(shown))
+	after := []rune(renderInput(line.afterCursor() + line.suggestion))
+	console.placeCursor(string(plain), string(plain[:len(plain)-len(after)]))
+}
+
+// Move the cursor from the end of the drawn text to the end of before, the
+// part of it ahead of the cursor, and remember the rows the line takes
+func (console *Console) placeCursor(drawn string, before string) {
+	width := console.width()
+	endRow, endColumn := screenPosition(drawn, width)
+	if endColumn == width {
+		// The terminal waits for the next character to wrap, go to the next
+		// row now so the cursor is where it is counted
+		console.print("\r\n")
+		endRow, endColumn = endRow+1, 0
+	}
+	row, column := screenPosition(before, width)
+	if column == width {
+		row, column = row+1, 0
+	}
+
+	if row == endRow {
+		if back := endColumn - column; back > 0 {
+			console.printf(ESCSEQ+"%vD", back)
+		}
+	} else {
+		console.printf(ESCSEQ+"%vA\r", endRow-row)
+		if column > 0 {
+			console.printf(ESCSEQ+"%vC", column)
+		}
+	}
+	console.row, console.rows = row, endRow+1
+}
+
+// Row and column the cursor is left at after text is printed from the start
+// of a row. Wide characters that don't fit at the end of a row go on the
+// next. The column is width when the row was just filled.
+func screenPosition(text string, width int) (row int, column int) {
+	for _, r := range text {
+		size := runewidth.RuneWidth(r)
+		if column+size > width {
+			row, column = row+1, 0
+		}
+		column += size
 	}
+	return row, column
 }
 
-func redrawLine(line commandLine, prompts []PromptSegment) {
-	fmt.Print("\r")
-	length := 0
-	for i, segment := range prompts {
-		length += len(renderSegment(segment, i+1 == len(prompts)))
+// Go to the first row of the line and clear it, and any menu below it
+func (console *Console) clearLine() {
+	if console.row > 0 {
+		console.printf(ESCSEQ+"%vA", console.row)
 	}
-	for i := 0; i < length+len(line.input); i++ { // clear line
-		fmt.Print(" ")
+	console.print("\r" + ESCSEQ + "J")
+	console.row, console.rows = 0, 1
+}
+
+// Go to the last row of the line, so what is printed next does not
+// overwrite the rest of it
+func (console *Console) moveBelowLine() {
+	if below := console.rows - 1 - console.row; below > 0 {
+		console.printf(ESCSEQ+"%vB", below)
 	}
-	fmt.Print("\r")
-	drawLine(line, prompts)
+	console.row = console.rows - 1
+}
+
+func (console *Console) redrawLine(line commandLine, prompts []PromptSegment) {
+	console.clearLine()
+	console.drawLine(line, prompts)
 }
 
 func newLine() commandLine {
-	return commandLine{"", "", 0, 0}
+	line := commandLine{kinds: make(map[string]string)}
+	if editMode == "vi" {
+		line.vi = &viState{}
+	}
+	return line
+}
+
+// A new line editing with the console's history, kill ring and keymap
+func (console *Console) newLine() commandLine {
+	line := newLine()
+	line.shared = console.state
+	return line
+}
+
+// The history, kill ring and keymap the line edits with. Lines not made by
+// a console use the default console's.
+func (line *commandLine) editor() *editorState {
+	if line.shared == nil {
+		return defaultConsole.state
+	}
+	return line.shared
+}
+
+// Copy of the line that shares nothing the editor changes, for drawing it
+// from another goroutine
+func (line commandLine) snapshot() commandLine {
+	if line.menu != nil {
+		menu := *line.menu
+		line.menu = &menu
+	}
+	if line.vi != nil {
+		vi := *line.vi
+		line.vi = &vi
+	}
+	if line.search != nil {
+		search := *line.search
+		line.search = &search
+	}
+	line.undoStack, line.redoStack = nil, nil
+	return line
+}
+
+// Number of runes in the line
+func (line *commandLine) length() int {
+	return utf8.RuneCountInString(line.input)
+}
+
+// The part of the input after the cursor
+func (line *commandLine) afterCursor() string {
+	return string([]rune(line.input)[line.cursor:])
 }
 
 // Input processing functions
 
-func getInput(prompts []PromptSegment, tabComplete func(string, int) string) string {
-	line := newLine()
+func (console *Console) getInput(segments []PromptSegment, tabComplete Completer) string {
+	// Segment providers are asked once, not on every redraw
+	prompts := resolveSegments(segments)
+	line := console.newLine()
+	console.showLine(line, prompts, false)
+	defer console.stopEditing()
 
 	for {
+		// Only wait a little while for the rest of an escape sequence
+		timeout := time.Duration(0)
+		if line.keys.pending() {
+			timeout = escapeTimeout
+		}
+
 		// read a single byte
-		buf := make([]byte, 1)
-		os.Stdin.Read(buf)
+		input, ok, err := console.readByte(timeout)
+		if err != nil {
+			// Like bash, treat the end of input as exit. A line that was not
+			// finished is dropped, the input may have been cut off mid command.
+			return "exit"
+		}
 
 		// process the single byte
-		finished := line.handleInput(buf[0], tabComplete)
-		redrawLine(line, prompts)
-		if finished {
+		var finished bool
+		if ok {
+			finished = line.handleInput(input, tabComplete)
+		} else {
+			finished = line.flushInput()
+		}
+		if line.clear {
+			console.clearScreen()
+			line.clear = false
+		}
+		if line.cancelled {
+			line = console.cancelLine(line, prompts)
+			continue
+		}
+		console.showLine(line, prompts, true)
+		if finished && !console.confirmLines(line.input) {
+			// Keep editing the pasted lines
+			line.done = false
+			console.showLine(line, prompts, true)
+		} else if finished {
 			break
 		}
 	}
 
-	if len(line.input) != 0 {
-		commandHistory.push(line.input)
+	if line.eof {
+		return "exit"
 	}
+	console.recordHistory(line.input)
 	return line.input
 }
 
-// Returns -1 if no escape sequence found
-func hasEscape(input string) int {
-	return strings.Index(input, ESCSEQ)
-}
-
-// Returns the found escape sequence, empty string if none found
-func getEscape(input string) string {
-	index := hasEscape(input)
-	if index != -1 {
-		for _, esc := range ALLESC {
-			if len(input) >= index+len(esc) {
-				test := input[index : index+len(esc)]
-				if test == esc {
-					return esc
-				}
-			}
+// Print the prompt and read a line, which the terminal echoes and edits
+// itself, for terminals that can't be redrawn
+func (console *Console) getPlainInput(prompts []PromptSegment) string {
+	console.DisplayPrompt(prompts)
+	input := make([]byte, 0, 80)
+	for {
+		b, _, err := console.readByte(0)
+		if err != nil {
+			// Like bash, treat the end of input as exit, dropping an
+			// unfinished line
+			return "exit"
+		}
+		if b == '\n' {
+			break
+		}
+		if b != '\r' {
+			input = append(input, b)
 		}
 	}
-	return ""
+	console.recordHistory(string(input))
+	return string(input)
 }
 
-// Process escape sequences
-func (line *commandLine) handleEscape(escape string) {
-	switch escape {
-	case LEFT:
-		if line.cursor > 0 {
-			line.cursor -= 1
-		}
-	case RIGHT:
-		if line.cursor < len(line.input) {
-			line.cursor += 1
-		}
-	case DELETE:
-		if line.cursor < len(line.input) {
-			line.input = deleteChar(line.input, line.cursor)
-		}
-	case HOME:
-		line.cursor = 0
-	case END:
-		line.cursor = len(line.input)
-	case UP:
-		prev := commandHistory.previous()
-		if prev != "" {
-			line.input = prev
-		}
-		line.cursor = len(line.input)
-	case DOWN:
-		next := commandHistory.next()
-		line.input = next
-		line.cursor = len(line.input)
+// Draw the line, clearing what was drawn before if redraw is set, and
+// remember it for Notify and for redrawing after a suspend
+func (console *Console) showLine(line commandLine, prompts []PromptSegment, redraw bool) {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	if redraw {
+		console.redrawLine(line, prompts)
+	} else {
+		console.drawLine(line, prompts)
+	}
+	console.setEditing(&line, prompts)
+}
+
+// Forget the line and leave the cursor on its last row
+func (console *Console) stopEditing() {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	console.setEditing(nil, nil)
+	console.moveBelowLine()
+	console.row, console.rows = 0, 1
+}
+
+// Leave the cancelled line on the screen marked with ^C and start a new one
+func (console *Console) cancelLine(line commandLine, prompts []PromptSegment) commandLine {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	line.suggestion = ""
+	line.menu = nil
+	line.cursor = line.length()
+	console.redrawLine(line, prompts)
+	console.print("^C")
+	next := console.newLine()
+	if line.length() == 0 {
+		console.print(" (Ctrl+C again to exit)")
+		next.lastAction = "cancel-line"
 	}
+	console.print("\r\n")
+	console.drawLine(next, prompts)
+	console.setEditing(&next, prompts)
+	return next
 }
 
-// Process input after an ESC character is found
-func (line *commandLine) handleEscapeInput(input byte) {
+// Insert a rune at the cursor and move past it
+func (line *commandLine) insert(r rune) {
+	line.input = insertChar(line.input, line.cursor, r)
+	line.cursor += 1
+}
 
-	char := byteToString(input)
+// Insert text at the cursor and move past it
+func (line *commandLine) insertText(text string) {
+	runes := []rune(line.input)
+	line.input = string(runes[:line.cursor]) + text + string(runes[line.cursor:])
+	line.cursor += utf8.RuneCountInString(text)
+}
 
-	// Push the next escape character
-	line.escape += char
+// Insert pasted text as it is, without running any key bindings
+func (line *commandLine) paste(text string) {
+	line.insertText(text)
+	line.lastAction = "paste"
+}
 
-	// Check if we match known escape sequences
-	esc := getEscape(line.escape)
-	if esc != "" {
-		line.handleEscape(esc)
-		line.escape = ""
+// Ask before running input that holds several lines, which is usually a
+// paste. Returns true if the input should run.
+func (console *Console) confirmLines(input string) bool {
+	lines := strings.Count(input, "\n") + 1
+	if lines == 1 {
+		return true
 	}
+	// Notifications go below the question until the line is shown again
+	console.mutex.Lock()
+	console.setEditing(nil, nil)
+	console.moveBelowLine()
+	console.printf("\r\nRun %v lines? [y/N] ", lines)
+	console.row, console.rows = 0, 1
+	console.mutex.Unlock()
+	answer, _, err := console.readByte(0)
+	if err == nil && (answer == 'y' || answer == 'Y') {
+		return true
+	}
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	console.print("\r\n")
+	return false
 }
 
-// Special characters such as tabs, backspaces etc
-func (line *commandLine) handleSpecialInput(input byte, tabComplete func(string, int) string) {
+// Returns true when line is complete
+func (line *commandLine) handleInput(input byte, tabComplete Completer) bool {
 
-	switch input {
-	case 0x7F: // backspace
-		if line.cursor > 0 {
-			line.input = deleteChar(line.input, line.cursor-1)
-			line.cursor -= 1 // Move cursor back one
-		}
-	case 0x09: // \t
-		completed := tabComplete(line.input, line.tabCount)
-
-		if len(completed) > 0 {
-			if strings.Index(completed, "\t") != -1 {
-				fmt.Printf("\n%v\n", completed)
-			} else {
-				line.input = completed
-				line.cursor = len(line.input)
-			}
+	//debug("Key: %v", input)
+
+	line.complete = tabComplete
+	for _, event := range line.keys.feed(input) {
+		if line.done {
+			break
 		}
-		line.tabCount = (line.tabCount + 1) % 2
-	case 0x0c: // Ctrl + l
-		clearScreen()
-	case 0x12: // Ctrl + r
-		//clearScreen()
-	case 0x04: // Ctrl + d
-		line.input = ""
-		line.cursor = 0
+		line.handleKeyEvent(event)
 	}
+	return line.done
 }
 
-// Returns true when line is complete
-func (line *commandLine) handleInput(input byte, tabComplete func(string, int) string) bool {
-
-	//debug("Key: %v", input)
+// Stop waiting for the rest of an escape sequence, a lone ESC is taken as the
+// Esc key. Returns true when line is complete.
+func (line *commandLine) flushInput() bool {
+	for _, event := range line.keys.flush() {
+		line.handleKeyEvent(event)
+	}
+	return line.done
+}
 
-	char := byteToString(input)
+// Act on a decoded key, recording any change it makes for undo
+func (line *commandLine) handleKeyEvent(event keyEvent) {
+	before := line.state()
+	if line.search != nil {
+		before = line.search.original.state()
+	}
+	previous := line.lastAction
 
-	switch char {
-	case "\n":
-		return true // Done
-	case ESC:
-		line.escape = ESC
+	line.dispatchKeyEvent(event)
+	if line.search == nil {
+		line.recordUndo(before, previous)
 	}
+	line.updateSuggestion()
+}
 
-	// If we are processing an escape sequence
-	if len(line.escape) != 0 {
-		line.handleEscapeInput(input)
-		return false
+func (line *commandLine) dispatchKeyEvent(event keyEvent) {
+	if line.menu != nil && !isCompleteAction(line.editor().keymap[event.String()]) {
+		line.menu = nil
 	}
+	switch {
+	case line.search != nil:
+		line.handleSearchKey(event)
+	case line.vi != nil:
+		line.handleViKey(event)
+	default:
+		line.handleEditKey(event)
+	}
+}
 
-	// If we are processing normal printable characters
-	if strings.Index(PRINTABLE, char) != -1 {
-		line.input = insertChar(line.input, line.cursor, input)
-		line.cursor += 1
-	} else {
-		line.handleSpecialInput(input, tabComplete)
+// Act on a key while editing: characters and pastes are inserted, anything
+// else goes to the keymap
+func (line *commandLine) handleEditKey(event keyEvent) {
+	switch {
+	case event.isChar() && line.keyPrefix == "":
+		line.insert(event.r)
+		line.lastAction = "self-insert"
+	case event.key == "Paste":
+		line.paste(event.text)
+	default:
+		line.handleKey(event.String())
 	}
-	return false
 }
 
 // Utility functions
 
+// Text as it is displayed on the input line. Pasted newlines and tabs are
+// shown as a single column each, so the cursor maths stays simple.
+func renderInput(input string) string {
+	return strings.NewReplacer("\n", "↵", "\t", "⇥").Replace(input)
+}
+
 // Convert a byte to a string type
 func byteToString(b byte) string {
 	buf := make([]byte, 1)
@@ -388,37 +644,92 @@ func byteToString(b byte) string {
 	return string(buf)
 }
 
-// Delete a character from a string at a given index
+// Delete a character from a string at a given rune index
 func deleteChar(input string, index int) string {
-	return input[:index] + input[index+1:]
+	runes := []rune(input)
+	return string(runes[:index]) + string(runes[index+1:])
 }
 
-// Insert a character into a string at a given index
-func insertChar(input string, index int, char byte) string {
+// Insert a character into a string at a given rune index
+func insertChar(input string, index int, char rune) string {
 	if len(input) == 0 {
-		return byteToString(char)
+		return string(char)
 	}
-	return (input[:index] + byteToString(char) + input[index:])
+	runes := []rune(input)
+	return string(runes[:index]) + string(char) + string(runes[index:])
+}
+
+// Number of terminal columns needed to display a string. Wide characters
+// take two columns, combining characters none.
+func displayWidth(input string) int {
+	return runewidth.StringWidth(input)
+}
+
+// Number of columns text takes on the screen, leaving out escape sequences
+func visibleWidth(text string) int {
+	return displayWidth(stripEscapes(text))
+}
+
+// The text without its CSI escape sequences
+func stripEscapes(text string) string {
+	plain := make([]rune, 0, len(text))
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == 0x1B && i+1 < len(runes) && runes[i+1] == '[' {
+			// Skip to the final byte of the CSI sequence
+			for i += 2; i < len(runes) && (runes[i] < 0x40 || runes[i] > 0x7E); i++ {
+			}
+			continue
+		}
+		plain = append(plain, runes[i])
+	}
+	return string(plain)
 }
 
 // TTY functions
 
-// Disables echo, disables newline buffering
-func prepareKeyboard() {
-	exec.Command("stty", "-F", "/dev/tty", "cbreak", "min", "1", "-echo").Run()
-	prepared = true
+// Disables echo, disables newline buffering and makes Ctrl+C a key. When the
+// console is not on a terminal input is read as it comes and the terminal is
+// left alone.
+func (console *Console) prepareKeyboard() {
+	console.mutex.Lock()
+	var err error
+	if console.isTerminal() {
+		err = enableRawMode()
+		handleSignals()
+	}
+	console.prepared = true
+	// Warnings are drawn through the console, which takes the mutex
+	console.mutex.Unlock()
+	if err != nil {
+		console.warning("Unable to set terminal mode: %v", err)
+	}
+}
+
+// Restores echo and the original terminal settings
+func (console *Console) resetKeyboard() {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	if console.isTerminal() {
+		disableRawMode()
+	}
+	console.prepared = false
 }
 
-// Enables echo and sane settings
-func resetKeyboard() {
-	exec.Command("stty", "-F", "/dev/tty", "icanon", "sane").Run()
+// Has the terminal been set up for line editing, see prepareKeyboard
+func (console *Console) isPrepared() bool {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
+	return console.prepared
 }
 
 // Clear the screen, reposition to top of screen
-func clearScreen() {
+func (console *Console) clearScreen() {
+	console.mutex.Lock()
+	defer console.mutex.Unlock()
 	// https://stackoverflow.com/questions/10105666/clearing-the-terminal-screen#15559322
-	fmt.Print(ESCSEQ + "2J" + END)
-	fmt.Print(ESCSEQ + "H" + END)
+	console.print(ESCSEQ + "2J" + END)
+	console.print(ESCSEQ + "H" + END)
 }
 
 ///// History Methods \\\\\
@@ -427,13 +738,25 @@ func (hist *history) isFull() bool {
 	return len(hist.commandHistory) == cap(hist.commandHistory)
 }
 
-// Push to history, returns index of last pushed item
+// Push to history, returns index of last pushed item. Repeating the last
+// command does not add a new item.
 func (hist *history) push(command string) int {
+	return hist.pushAt(command, time.Now())
+}
+
+// Push a command entered at a given time
+func (hist *history) pushAt(command string, when time.Time) int {
+	last := len(hist.commandHistory) - 1
+	if last >= 0 && hist.commandHistory[last] == command {
+		hist.index = len(hist.commandHistory)
+		return last
+	}
+
 	// If we reused a history item
 	if hist.index < len(hist.commandHistory) {
 		// If we did not edit this command, then swap it to the end
 		if hist.commandHistory[hist.index] == command {
-			hist.reuse(hist.index)
+			hist.reuse(hist.index, when)
 			hist.index = len(hist.commandHistory)
 			return hist.index
 		}
@@ -446,15 +769,17 @@ func (hist *history) push(command string) int {
 		new = append(new, hist.commandHistory[1:]...)
 
 		hist.commandHistory = append(new, command)
+		hist.times = append(hist.times[1:], when)
 	} else {
 		hist.commandHistory = append(hist.commandHistory, command)
+		hist.times = append(hist.times, when)
 	}
 	hist.index = len(hist.commandHistory)
 	return len(hist.commandHistory) - 1
 }
 
-// Moves a history item at 'index' to the end
-func (hist *history) reuse(index int) int {
+// Moves a history item at 'index' to the end, entered again at 'when'
+func (hist *history) reuse(index int, when time.Time) int {
 	if index >= len(hist.commandHistory) {
 		return -1
 	}
@@ -464,6 +789,10 @@ func (hist *history) reuse(index int) int {
 	new = append(new, hist.commandHistory[index+1:]...)
 	new = append(new, command)
 	hist.commandHistory = new
+	times := make([]time.Time, 0, cap(hist.commandHistory))
+	times = append(times, hist.times[:index]...)
+	times = append(times, hist.times[index+1:]...)
+	hist.times = append(times, when)
 	return len(hist.commandHistory) - 1
 }
 
@@ -500,11 +829,21 @@ func (hist *history) previous() (prev string) {
 func newHistory(capacity int) history {
 	return history{
 		make([]string, 0, capacity),
+		make([]time.Time, 0, capacity),
 		0,
 	}
 }
 
-// Returns -1 if no match found, otherwise the index of the first occurance
-func searchHistory(partial string, start int) int {
+// Returns -1 if no match found, otherwise the index of the newest item
+// containing partial, looking back from index start
+func (hist *history) search(partial string, start int) int {
+	if start >= len(hist.commandHistory) {
+		start = len(hist.commandHistory) - 1
+	}
+	for i := start; i >= 0; i-- {
+		if strings.Contains(hist.commandHistory[i], partial) {
+			return i
+		}
+	}
 	return -1
 }
@@ -1,13 +1,26 @@
 package ui
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+	"time"
 )
 
+// Feed keys to a line like a user typing them and then pausing, so a
+// trailing ESC is taken as the Esc key. Returns true when the line is
+// complete.
+func typeKeys(line *commandLine, keys string, tc Completer) bool {
+	for i := 0; i < len(keys); i++ {
+		line.handleInput(keys[i], tc)
+	}
+	return line.flushInput()
+}
+
 func TestInsertChar(t *testing.T) {
 	cases := []struct {
 		target   string
-		char     byte
+		char     rune
 		index    int
 		expected string
 	}{
@@ -17,6 +30,8 @@ func TestInsertChar(t *testing.T) {
 		{"asdf", '1', 2, "as1df"},
 		{"asdf", '1', 3, "asd1f"},
 		{"asdf", '1', 4, "asdf1"},
+		{"äöü", 'ß', 1, "äßöü"},
+		{"日本", '語', 2, "日本語"},
 	}
 
 	for _, c := range cases {
@@ -38,6 +53,8 @@ func TestDeleteChar(t *testing.T) {
 		{"asdf", 1, "adf"},
 		{"asdf", 2, "asf"},
 		{"asdf", 3, "asd"},
+		{"äöü", 1, "äü"},
+		{"日本語", 2, "日本"},
 	}
 
 	for _, c := range cases {
@@ -86,7 +103,7 @@ func TestHistoryPush(t *testing.T) {
 
 func TestLineHandleInput(t *testing.T) {
 	line := newLine()
-	tc := func(partial string, count int) string { return "" }
+	tc := NilTabComplete
 
 	//finished := line.handleInput(buf[0], tabComplete)
 	cases := []struct {
@@ -100,7 +117,8 @@ func TestLineHandleInput(t *testing.T) {
 		{'!', "ABC!", false},
 		{' ', "ABC! ", false},
 		{0x7f, "ABC!", false}, // backspace
-		{0x04, "", false},     // Ctrl + D
+		{0x04, "ABC!", false}, // Ctrl + D at the end of the line
+		{0x15, "", false},     // Ctrl + U
 		{'A', "A", false},
 		{'\n', "A", true},
 	}
@@ -139,8 +157,9 @@ func TestHistoryReuse(t *testing.T) {
 		{1, 3, "C", "D"}, // CABD
 	}
 
-	for _, c := range cases {
-		got := hist.reuse(c.index)
+	for i, c := range cases {
+		when := time.Unix(int64(i), 0)
+		got := hist.reuse(c.index, when)
 
 		if got != c.expected_index {
 			t.Errorf("history.reuse(%q) == %q, want %q",
@@ -161,5 +180,207 @@ func TestHistoryReuse(t *testing.T) {
 		if cap(hist.commandHistory) != 5 {
 			t.Errorf("history.commandHistory did not maintain max capacity")
 		}
+		if len(hist.times) != len(hist.commandHistory) || !hist.times[len(hist.times)-1].Equal(when) {
+			t.Errorf("history.times == %v, want %v items ending with %v",
+				hist.times, len(hist.commandHistory), when)
+		}
+	}
+}
+
+func TestLineHandleUTF8Input(t *testing.T) {
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys     string
+		expected string
+		cursor   int
+		width    int
+	}{
+		{"é", "é", 1, 1},
+		{"日本語", "日本語", 3, 6},
+		{"日本語\x7f", "日本", 2, 4},
+		{"äöü" + LEFT + LEFT + "\x7f", "öü", 0, 2},
+		{"äöü" + LEFT + DELETE, "äö", 2, 2},
+		{"é", "é", 2, 1},         // combining accent
+		{"a\xff\xfeb", "ab", 2, 2}, // invalid bytes are dropped
+	}
+
+	for _, c := range cases {
+		line := newLine()
+		for i := 0; i < len(c.keys); i++ {
+			line.handleInput(c.keys[i], tc)
+		}
+		if line.input != c.expected {
+			t.Errorf("handleInput(%q).input = %q, want %q",
+				c.keys, line.input, c.expected)
+		}
+		if line.cursor != c.cursor {
+			t.Errorf("handleInput(%q).cursor = %v, want %v",
+				c.keys, line.cursor, c.cursor)
+		}
+		if got := displayWidth(line.input); got != c.width {
+			t.Errorf("displayWidth(%q) = %v, want %v",
+				line.input, got, c.width)
+		}
+	}
+}
+
+func TestLinePaste(t *testing.T) {
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys     string
+		expected string
+		cursor   int
+		finished bool
+	}{
+		{PASTE_START + "ls -l" + PASTE_END, "ls -l", 5, false},
+		{"ab" + LEFT + PASTE_START + "日本" + PASTE_END, "a日本b", 3, false},
+		{PASTE_START + "\x01\x15\t" + PASTE_END + "x", "\tx", 2, false},
+		{PASTE_START + "id\nls\n" + PASTE_END, "id\nls\n", 6, false},
+		{PASTE_START + "id\nls" + PASTE_END + "\n", "id\nls", 5, true},
+	}
+
+	for _, c := range cases {
+		line := newLine()
+		finished := typeKeys(&line, c.keys, tc)
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("paste %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+		if finished != c.finished {
+			t.Errorf("paste %q finished = %v, want %v", c.keys, finished, c.finished)
+		}
+	}
+
+	if got := renderInput("a\tb\nc"); displayWidth(got) != 5 {
+		t.Errorf("renderInput(%q) = %q, want 5 columns", "a\tb\nc", got)
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	hist := newHistory(5)
+	for _, c := range []string{"ls /tmp", "cat /etc/passwd", "ls -la", "id"} {
+		hist.push(c)
+	}
+
+	cases := []struct {
+		partial  string
+		start    int
+		expected int
+	}{
+		{"ls", 3, 2},
+		{"ls", 1, 0},
+		{"ls", 10, 2},
+		{"passwd", 3, 1},
+		{"passwd", 0, -1},
+		{"", 3, 3},
+		{"nmap", 3, -1},
+	}
+
+	for _, c := range cases {
+		got := hist.search(c.partial, c.start)
+		if got != c.expected {
+			t.Errorf("history.search(%q, %v) == %v, want %v",
+				c.partial, c.start, got, c.expected)
+		}
+	}
+}
+
+// Give lines without a console fresh editing state with the commands in the
+// history, restored by the returned func
+func withHistory(commands ...string) func() {
+	saved := defaultConsole.state
+	defaultConsole.state = newEditorState()
+	for _, command := range commands {
+		defaultConsole.state.history.push(command)
+	}
+	return func() { defaultConsole.state = saved }
+}
+
+func TestLineReverseSearch(t *testing.T) {
+	defer withHistory("ls /tmp", "cat /etc/passwd", "ls -la", "id")()
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys      string
+		expected  string
+		cursor    int
+		searching bool
+		finished  bool
+	}{
+		{"\x12ls", "ls -la", 0, true, false},
+		{"\x12ls\x12", "ls /tmp", 0, true, false},
+		{"\x12ls\x12\x12", "ls /tmp", 0, true, false},
+		{"\x12tmp", "ls /tmp", 4, true, false},
+		{"\x12ls\x7f\x7fid", "id", 0, true, false},
+		{"\x12passwd\n", "cat /etc/passwd", 9, false, true},
+		{"abc\x12ls\x07", "abc", 3, false, false},
+		{"abc\x12ls" + ESC, "abc", 3, false, false},
+		{"\x12ls\x7f", "ls -la", 0, true, false},
+		{"\x12" + PASTE_START + "tmp" + PASTE_END, "ls /tmp", 4, true, false},
+		{"abc\x12l\x7f", "abc", 3, true, false},
+		{"abc\x12\x12", "abc", 3, true, false},
+		{"abc\x12l\x7f\n", "abc", 3, false, true},
+	}
+
+	for _, c := range cases {
+		line := newLine()
+		finished := typeKeys(&line, c.keys, tc)
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("reverse search %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+		if (line.search != nil) != c.searching {
+			t.Errorf("reverse search %q searching = %v, want %v",
+				c.keys, line.search != nil, c.searching)
+		}
+		if finished != c.finished {
+			t.Errorf("reverse search %q finished = %v, want %v",
+				c.keys, finished, c.finished)
+		}
+	}
+}
+
+func TestLineSnapshot(t *testing.T) {
+	line := commandLine{input: "ls", cursor: 2, vi: &viState{},
+		menu: &completionMenu{[]Candidate{{Text: "a"}, {Text: "b"}}, lineState{}, -1}}
+	console := NewConsole(strings.NewReader(""), &bytes.Buffer{}, nil)
+	console.setEditing(&line, nil)
+
+	line.input = "ls -l"
+	line.menu.selected = 1
+	line.vi.normal = true
+	copied := console.editing
+	if copied.input != "ls" || copied.menu.selected != -1 || copied.vi.normal {
+		t.Errorf("snapshot changed with the line: %+v", copied)
+	}
+
+	console.setEditing(nil, nil)
+	if console.editing != nil {
+		t.Errorf("setEditing(nil) kept %+v", console.editing)
+	}
+}
+
+func TestScreenPosition(t *testing.T) {
+	cases := []struct {
+		text   string
+		row    int
+		column int
+	}{
+		{"", 0, 0},
+		{"abc", 0, 3},
+		{"abcdefghij", 0, 10},
+		{"abcdefghijk", 1, 1},
+		{"abcdefghijklmnopqrstuvwxyz", 2, 6},
+		{"abcdefghi世", 1, 2},
+		{"abcdefgh世", 0, 10},
+	}
+
+	for _, c := range cases {
+		if row, column := screenPosition(c.text, 10); row != c.row || column != c.column {
+			t.Errorf("screenPosition(%q, 10) = %v, %v, want %v, %v", c.text, row, column,
+				c.row, c.column)
+		}
 	}
 }
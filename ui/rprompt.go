@@ -0,0 +1,84 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+	The right prompt, drawn at the right edge of the input line when the
+	rprompt option is on. It shows how long the last command took if that was
+	longer than rpromptduration, whether it succeeded and the time. It is left
+	out when the input comes too close to it.
+*/
+
+var (
+	rightPromptEnabled = false
+	// Commands that take longer than this have their duration shown
+	rightPromptDuration = 2 * time.Second
+)
+
+func registerRightPromptOptions() {
+	RegisterBoolOption("rprompt",
+		"Show the last command's result and the time on the right, on or off",
+		&rightPromptEnabled)
+	RegisterOption("rpromptduration",
+		"Show how long the last command took when longer than this, e.g. 2s",
+		rightPromptDuration.String(), setRightPromptDuration)
+}
+
+func setRightPromptDuration(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return errors.New(fmt.Sprintf("Invalid duration '%v'", value))
+	}
+	rightPromptDuration = duration
+	return nil
+}
+
+// The right prompt as it is displayed
+func renderRightPrompt(now time.Time) string {
+	parts := make([]string, 0, 3)
+	if commandRun && lastDuration > rightPromptDuration {
+		parts = append(parts, themeColorize(formatDuration(lastDuration), "duration"))
+	}
+	if commandRun && lastStatus == 0 {
+		parts = append(parts, themeColorize(currentTheme.ok, "success"))
+	} else if commandRun {
+		parts = append(parts, themeColorize(currentTheme.fail, "failure"))
+	}
+	parts = append(parts, themeColorize(now.Format("15:04:05"), "time"))
+	return strings.Join(parts, " ")
+}
+
+// Draw the right prompt, unless the prompt and input already take used
+// columns and would run into it. The cursor is left at the start of the
+// line.
+func (console *Console) drawRightPrompt(used int) {
+	if !rightPromptEnabled {
+		return
+	}
+	text := renderRightPrompt(time.Now())
+	// Keep a gap before it and the last column free, so it never wraps
+	column := console.width() - visibleWidth(text) - 1
+	if column <= used+1 {
+		return
+	}
+	console.printf("\r"+ESCSEQ+"%vC%v\r", column, text)
+}
+
+// Durations to a tenth of a second, or to the second from a minute on
+func formatDuration(duration time.Duration) string {
+	if duration >= time.Minute {
+		return duration.Round(time.Second).String()
+	}
+	return duration.Round(100 * time.Millisecond).String()
+}
+
+// Text in a style of the current theme
+func themeColorize(text string, style string) string {
+	fg, bg, _ := themeStyle(style)
+	return colorize(text, fg, bg)
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"github.com/fatih/color"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Set the result of the last command, restored by the returned func
+func setLastCommand(run bool, status int, duration time.Duration) func() {
+	savedRun, savedStatus, savedDuration := commandRun, lastStatus, lastDuration
+	commandRun, lastStatus, lastDuration = run, status, duration
+	return func() {
+		commandRun, lastStatus, lastDuration = savedRun, savedStatus, savedDuration
+	}
+}
+
+func TestRenderRightPrompt(t *testing.T) {
+	defer func(saved bool) { color.NoColor = saved }(color.NoColor)
+	color.NoColor = true
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		run      bool
+		status   int
+		duration time.Duration
+		expected string
+	}{
+		{false, 0, 0, "15:04:05"},
+		{true, 0, time.Second, "✔ 15:04:05"},
+		{true, 2, time.Second, "✘ 15:04:05"},
+		{true, 0, 2500 * time.Millisecond, "2.5s ✔ 15:04:05"},
+		{true, 1, 95*time.Second + 400*time.Millisecond, "1m35s ✘ 15:04:05"},
+	}
+
+	for _, c := range cases {
+		restore := setLastCommand(c.run, c.status, c.duration)
+		if got := renderRightPrompt(now); got != c.expected {
+			t.Errorf("renderRightPrompt after %v, %v = %q, want %q", c.status,
+				c.duration, got, c.expected)
+		}
+		restore()
+	}
+}
+
+func TestScreenRightPrompt(t *testing.T) {
+	defer screenTestSetup()()
+	defer setLastCommand(true, 1, 3*time.Second)()
+	defer func(saved bool) { rightPromptEnabled = saved }(rightPromptEnabled)
+	rightPromptEnabled = true
+
+	// gobar > takes 8 columns, 3s ✘ 00:00:00 13 from column 26, leaving the
+	// last one free
+	shown := regexp.MustCompile(`^gobar > (.*?) +3s ✘ \d\d:\d\d:\d\d$`)
+	cases := []struct {
+		keys  string
+		input string
+		shown bool
+		col   int
+	}{
+		{"", "", true, 8},
+		{"ls -l\x02", "ls -l", true, 12},
+		{strings.Repeat("a", 16), strings.Repeat("a", 16), true, 24},
+		{strings.Repeat("a", 17), strings.Repeat("a", 17), false, 25},
+		{strings.Repeat("a", 17) + "\x7f", strings.Repeat("a", 16), true, 24},
+	}
+
+	for _, c := range cases {
+		screen := runScreen(40, c.keys, NilTabComplete)
+		text := screen.text()
+		match := shown.FindStringSubmatch(text)
+		if c.shown && (match == nil || match[1] != c.input) {
+			t.Errorf("screen after %q = %q, want the right prompt after %q", c.keys,
+				text, c.input)
+		} else if !c.shown && text != "gobar > "+c.input {
+			t.Errorf("screen after %q = %q, want no right prompt", c.keys, text)
+		}
+		if screen.row != 0 || screen.col != c.col {
+			t.Errorf("cursor after %q at %v,%v, want 0,%v", c.keys, screen.row,
+				screen.col, c.col)
+		}
+		if c.shown && screen.cells[0][38].r == ' ' || screen.cells[0][39].r != ' ' {
+			t.Errorf("right prompt after %q does not end in column 38", c.keys)
+		}
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	cases := []struct {
+		text  string
+		width int
+	}{
+		{"", 0},
+		{"gobar", 5},
+		{"\x1b[30;47mgobar \x1b[0m\x1b[37m\ue0b0\x1b[0m ", 8},
+		{"\x1b[38;2;1;2;3m日本\x1b[0m", 4},
+	}
+
+	for _, c := range cases {
+		if got := visibleWidth(c.text); got != c.width {
+			t.Errorf("visibleWidth(%q) = %v, want %v", c.text, got, c.width)
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/mattn/go-runewidth"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+/*
+	An in-memory VT100 screen for testing what the line editor draws. It
+	understands the subset of ANSI output gobar uses: printing with deferred
+	line wrapping, CR, LF, backspace, cursor movement (CSI A B C D H), erasing
+	(CSI J K) and colours and attributes (CSI m). Anything else is ignored.
+*/
+
+// A character on the screen and how it is drawn
+type screenCell struct {
+	r         rune
+	fg        string // SGR colour parameters, e.g. "31" or "38;5;208"
+	bg        string
+	bold      bool
+	dim       bool
+	italic    bool
+	underline bool
+	reverse   bool
+}
+
+type virtualScreen struct {
+	width, height int
+	cells         [][]screenCell
+	row, col      int
+	wrapPending   bool       // the last column was just written
+	pen           screenCell // attributes for new characters
+	pending       []byte     // incomplete escape sequence or character
+}
+
+func newVirtualScreen(width, height int) *virtualScreen {
+	screen := &virtualScreen{width: width, height: height}
+	screen.cells = make([][]screenCell, height)
+	for i := range screen.cells {
+		screen.cells[i] = screen.blankRow()
+	}
+	return screen
+}
+
+func (screen *virtualScreen) blankRow() []screenCell {
+	row := make([]screenCell, screen.width)
+	for i := range row {
+		row[i].r = ' '
+	}
+	return row
+}
+
+// Size provider for a Console drawing on the screen
+func (screen *virtualScreen) size() (int, int) {
+	return screen.width, screen.height
+}
+
+func (screen *virtualScreen) Write(data []byte) (int, error) {
+	screen.pending = append(screen.pending, data...)
+	for len(screen.pending) > 0 {
+		n := screen.interpret(screen.pending)
+		if n == 0 {
+			break // wait for the rest
+		}
+		screen.pending = screen.pending[n:]
+	}
+	return len(data), nil
+}
+
+// Interpret the start of data, returns how many bytes were used or 0 if more
+// are needed
+func (screen *virtualScreen) interpret(data []byte) int {
+	switch data[0] {
+	case '\r':
+		screen.col, screen.wrapPending = 0, false
+		return 1
+	case '\n':
+		screen.lineFeed()
+		return 1
+	case '\b':
+		if screen.col > 0 {
+			screen.col--
+		}
+		screen.wrapPending = false
+		return 1
+	case 0x1B:
+		return screen.escape(data)
+	}
+	if data[0] < 0x20 || data[0] == 0x7F {
+		return 1
+	}
+	if !utf8.FullRune(data) {
+		return 0
+	}
+	r, size := utf8.DecodeRune(data)
+	screen.put(r)
+	return size
+}
+
+func (screen *virtualScreen) lineFeed() {
+	screen.wrapPending = false
+	if screen.row < screen.height-1 {
+		screen.row++
+		return
+	}
+	screen.cells = append(screen.cells[1:], screen.blankRow())
+}
+
+func (screen *virtualScreen) put(r rune) {
+	width := runewidth.RuneWidth(r)
+	if width == 0 {
+		return // combining characters are not tracked
+	}
+	if screen.wrapPending || screen.col+width > screen.width {
+		screen.col = 0
+		screen.lineFeed()
+	}
+	cell := screen.pen
+	cell.r = r
+	screen.cells[screen.row][screen.col] = cell
+	if width == 2 {
+		cell.r = 0 // right half of a wide character
+		screen.cells[screen.row][screen.col+1] = cell
+	}
+	screen.col += width
+	if screen.col >= screen.width {
+		screen.col = screen.width - 1
+		screen.wrapPending = true
+	}
+}
+
+// Interpret an escape sequence, returns its length or 0 if it is incomplete
+func (screen *virtualScreen) escape(data []byte) int {
+	if len(data) < 2 {
+		return 0
+	}
+	if data[1] != '[' {
+		return 2
+	}
+	end := 2
+	for end < len(data) && (data[end] < 0x40 || data[end] > 0x7E) {
+		end++
+	}
+	if end == len(data) {
+		return 0
+	}
+	params := string(data[2:end])
+	if strings.HasPrefix(params, "?") {
+		return end + 1 // private modes, such as bracketed paste
+	}
+	args := make([]int, 0, 2)
+	for _, param := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(param)
+		args = append(args, n)
+	}
+	arg := func(i, otherwise int) int {
+		if i < len(args) && args[i] != 0 {
+			return args[i]
+		}
+		return otherwise
+	}
+
+	screen.wrapPending = false
+	switch data[end] {
+	case 'A':
+		screen.row = clampInt(screen.row-arg(0, 1), 0, screen.height-1)
+	case 'B':
+		screen.row = clampInt(screen.row+arg(0, 1), 0, screen.height-1)
+	case 'C':
+		screen.col = clampInt(screen.col+arg(0, 1), 0, screen.width-1)
+	case 'D':
+		screen.col = clampInt(screen.col-arg(0, 1), 0, screen.width-1)
+	case 'H', 'f':
+		screen.row = clampInt(arg(0, 1)-1, 0, screen.height-1)
+		screen.col = clampInt(arg(1, 1)-1, 0, screen.width-1)
+	case 'J':
+		screen.erase(args[0], true)
+	case 'K':
+		screen.erase(args[0], false)
+	case 'm':
+		screen.setAttributes(args)
+	}
+	return end + 1
+}
+
+// Erase after the cursor (0), before it (1) or all of it (2), on the screen
+// or on the cursor's row
+func (screen *virtualScreen) erase(mode int, wholeScreen bool) {
+	first, last := screen.row, screen.row
+	if wholeScreen {
+		first, last = 0, screen.height-1
+	}
+	for row := first; row <= last; row++ {
+		for col := 0; col < screen.width; col++ {
+			before := row < screen.row || (row == screen.row && col < screen.col)
+			if mode == 2 || (mode == 0 && !before) || (mode == 1 && (before || col == screen.col && row == screen.row)) {
+				screen.cells[row][col] = screenCell{r: ' '}
+			}
+		}
+	}
+}
+
+func (screen *virtualScreen) setAttributes(args []int) {
+	for i := 0; i < len(args); i++ {
+		code := args[i]
+		colour := strconv.Itoa(code)
+		if (code == 38 || code == 48) && i+2 < len(args) && args[i+1] == 5 {
+			colour = fmt.Sprintf("%v;5;%v", code, args[i+2])
+			i += 2
+		} else if (code == 38 || code == 48) && i+4 < len(args) && args[i+1] == 2 {
+			colour = fmt.Sprintf("%v;2;%v;%v;%v", code, args[i+2], args[i+3], args[i+4])
+			i += 4
+		}
+		switch {
+		case code == 0:
+			screen.pen = screenCell{}
+		case code == 1:
+			screen.pen.bold = true
+		case code == 2:
+			screen.pen.dim = true
+		case code == 3:
+			screen.pen.italic = true
+		case code == 4:
+			screen.pen.underline = true
+		case code == 7:
+			screen.pen.reverse = true
+		case code >= 30 && code <= 38 || code >= 90 && code <= 97:
+			screen.pen.fg = colour
+		case code >= 40 && code <= 48 || code >= 100 && code <= 107:
+			screen.pen.bg = colour
+		}
+	}
+}
+
+// The screen contents, with trailing blanks and empty rows removed
+func (screen *virtualScreen) text() string {
+	rows := make([]string, 0, screen.height)
+	for _, row := range screen.cells {
+		text := ""
+		for _, cell := range row {
+			if cell.r != 0 {
+				text += string(cell.r)
+			}
+		}
+		rows = append(rows, strings.TrimRight(text, " "))
+	}
+	return strings.TrimRight(strings.Join(rows, "\n"), "\n")
+}
+
+func clampInt(n, low, high int) int {
+	if n < low {
+		return low
+	}
+	if n > high {
+		return high
+	}
+	return n
+}
+
+// Type keys into a console drawing on a screen, stopping when the keys run
+// out. The console's history holds the given commands.
+func runScreen(width int, keys string, complete Completer, history ...string) *virtualScreen {
+	screen := newVirtualScreen(width, 10)
+	console := NewConsole(strings.NewReader(keys), screen, screen.size)
+	for _, command := range history {
+		console.state.history.push(command)
+	}
+	console.GetUserInput([]PromptSegment{NewPromptSegment("gobar", "black", "white")},
+		complete)
+	return screen
+}
+
+// Set up plain prompts, restored by the returned func
+func screenTestSetup() func() {
+	savedEnd, savedColor := *prompt_end, color.NoColor
+	*prompt_end = ">"
+	color.NoColor = false
+	return func() {
+		*prompt_end = savedEnd
+		color.NoColor = savedColor
+	}
+}
+
+func TestVirtualScreen(t *testing.T) {
+	cases := []struct {
+		output string
+		text   string
+		row    int
+		col    int
+	}{
+		{"hello", "hello", 0, 5},
+		{"hello\r\nworld", "hello\nworld", 1, 5},
+		{"abcdefghij", "abcdefghij", 0, 9},
+		{"abcdefghijk", "abcdefghij\nk", 1, 1},
+		{"abcdefghij\r\n", "abcdefghij", 1, 0},
+		{"日本語日本", "日本語日本", 0, 9},
+		{"日本語日本語", "日本語日本\n語", 1, 2},
+		{"abc\x1b[2Dx", "axc", 0, 2},
+		{"abc\x1b[1;2Hx", "axc", 0, 2},
+		{"a\r\nb\x1b[Ac", "ac\nb", 0, 2},
+		{"abc\x1b[2D\x1b[K", "a", 0, 1},
+		{"abc\r\ndef\x1b[A\r\x1b[J", "", 0, 0},
+		{"abc\x1b[2J", "", 0, 3},
+		{"a\x1b[?2004hb", "ab", 0, 2},
+		{"\x1b[31mred\x1b[0m", "red", 0, 3},
+	}
+
+	for _, c := range cases {
+		screen := newVirtualScreen(10, 5)
+		// Write a byte at a time, sequences can be split between writes
+		for i := 0; i < len(c.output); i++ {
+			screen.Write([]byte{c.output[i]})
+		}
+		if got := screen.text(); got != c.text || screen.row != c.row || screen.col != c.col {
+			t.Errorf("screen(%q) = %q at %v,%v, want %q at %v,%v", c.output,
+				got, screen.row, screen.col, c.text, c.row, c.col)
+		}
+	}
+
+	screen := newVirtualScreen(10, 2)
+	screen.Write([]byte("one\r\ntwo\r\nthree"))
+	if got := screen.text(); got != "two\nthree" {
+		t.Errorf("scrolled screen = %q, want %q", got, "two\nthree")
+	}
+	screen.Write([]byte("\x1b[31;42;2mx"))
+	if cell := screen.cells[1][5]; cell.fg != "31" || cell.bg != "42" || !cell.dim {
+		t.Errorf("attributes = %+v, want red on green, dim", cell)
+	}
+	screen.Write([]byte("\x1b[0;1;38;5;208;48;2;1;2;3;4mx"))
+	if cell := screen.cells[1][6]; cell.fg != "38;5;208" || cell.bg != "48;2;1;2;3" ||
+		!cell.bold || !cell.underline || cell.dim {
+		t.Errorf("attributes = %+v, want bold underlined 208 on #010203", cell)
+	}
+}
+
+func TestScreenEditing(t *testing.T) {
+	defer screenTestSetup()()
+
+	cases := []struct {
+		keys string
+		text string
+		row  int
+		col  int
+	}{
+		{"", "gobar >", 0, 8},
+		{"hello", "gobar > hello", 0, 13},
+		{"hello\x02\x02", "gobar > hello", 0, 11},
+		{"hello\x01", "gobar > hello", 0, 8},
+		{"日本語\x02", "gobar > 日本語", 0, 12},
+		{"ab\x7f\x7fcd", "gobar > cd", 0, 10},
+		{"l", "gobar > ls -la /tmp", 0, 9},
+		{"l\x02", "gobar > l", 0, 8},
+		{"\x10", "gobar > cat /etc/passwd", 0, 23},
+		{"\x12ls", "(reverse-i-search)`ls': ls -la /tmp", 0, 24},
+		{"\x12zz", "(failed reverse-i-search)`zz':", 0, 31},
+		{"ab\x12l\x7f", "(reverse-i-search)`': ab", 0, 24},
+		{PASTE_START + "a\tb" + PASTE_END, "gobar > a⇥b", 0, 11},
+		{PASTE_START + "id\nls" + PASTE_END, "gobar > id↵ls", 0, 13},
+	}
+
+	for _, c := range cases {
+		screen := runScreen(40, c.keys, NilTabComplete, "ls -la /tmp", "cat /etc/passwd")
+		if got := screen.text(); got != c.text || screen.row != c.row || screen.col != c.col {
+			t.Errorf("screen after %q = %q at %v,%v, want %q at %v,%v", c.keys,
+				got, screen.row, screen.col, c.text, c.row, c.col)
+		}
+	}
+}
+
+// Matches are shown the way the line shows them, newlines and all
+func TestScreenSearchRendering(t *testing.T) {
+	defer screenTestSetup()()
+	screen := runScreen(40, "\x12y", NilTabComplete, "x\ny")
+	if got := screen.text(); got != "(reverse-i-search)`y': x↵y" || screen.row != 0 ||
+		screen.col != 25 {
+		t.Errorf("search = %q at %v,%v, want %q at 0,25", got, screen.row, screen.col,
+			"(reverse-i-search)`y': x↵y")
+	}
+}
+
+func TestScreenColours(t *testing.T) {
+	defer screenTestSetup()()
+	defer func(saved map[string]command) { commands = saved }(commands)
+	commands = map[string]command{"help": command{name: "help"}}
+
+	screen := runScreen(40, "he", NilTabComplete, "help me")
+	// Prompt segment: black on white
+	if cell := screen.cells[0][0]; cell.r != 'g' || cell.fg != "30" || cell.bg != "47" {
+		t.Errorf("prompt cell = %+v, want black on white 'g'", cell)
+	}
+	// Input: an unknown command is red, the suggestion dim
+	if cell := screen.cells[0][8]; cell.r != 'h' || cell.fg != "31" {
+		t.Errorf("input cell = %+v, want red 'h'", cell)
+	}
+	if cell := screen.cells[0][10]; cell.r != 'l' || !cell.dim {
+		t.Errorf("suggestion cell = %+v, want dim 'l'", cell)
+	}
+
+	screen = runScreen(40, "help", NilTabComplete, "help me")
+	if cell := screen.cells[0][8]; cell.fg != "32" {
+		t.Errorf("command cell = %+v, want green", cell)
+	}
+}
+
+func TestScreenCompletionMenu(t *testing.T) {
+	defer screenTestSetup()()
+	complete := func(input string, cursor int) []Candidate {
+		return completeWords(input, cursor, []string{"cat", "chmod", "chown", "cp"}, nil)
+	}
+
+	screen := runScreen(22, "c\t", complete)
+	expected := "gobar > c\ncat    chmod  chown\ncp"
+	if got := screen.text(); got != expected || screen.row != 0 || screen.col != 9 {
+		t.Errorf("menu = %q at %v,%v, want %q at 0,9", got, screen.row, screen.col, expected)
+	}
+
+	screen = runScreen(22, "c\t\t\t", complete)
+	if cell := screen.cells[1][7]; cell.r != 'c' || !cell.reverse {
+		t.Errorf("selected cell = %+v, want reversed 'c'", cell)
+	}
+	if got := strings.Split(screen.text(), "\n")[0]; got != "gobar > chmod" || screen.col != 14 {
+		t.Errorf("line with selection = %q at %v, want %q at 14", got, screen.col, "gobar > chmod")
+	}
+
+	// Any other key closes the menu
+	screen = runScreen(22, "c\t\tx", complete)
+	if got := screen.text(); got != "gobar > cat x" {
+		t.Errorf("after closing the menu = %q, want %q", got, "gobar > cat x")
+	}
+}
+
+func TestScreenCancelLine(t *testing.T) {
+	defer screenTestSetup()()
+
+	cases := []struct {
+		keys  string
+		input string
+		text  string
+	}{
+		{"abc\x03", "exit", "gobar > abc^C\ngobar >"},
+		{"abc\x02\x03xy", "exit", "gobar > abc^C\ngobar > xy"},
+		{"\x03", "exit", "gobar > ^C (Ctrl+C again to exit)\ngobar >"},
+		{"\x03\x03", "exit", "gobar > ^C (Ctrl+C again to exit)\ngobar >"},
+		{"\x03x\x7f\x03\x03", "exit",
+			"gobar > ^C (Ctrl+C again to exit)\ngobar > ^C (Ctrl+C again to exit)\ngobar >"},
+		{"\x03ls\r", "ls", "gobar > ^C (Ctrl+C again to exit)\ngobar > ls"},
+		{"ab\x03\x03ls\r", "ls", "gobar > ab^C\ngobar > ^C (Ctrl+C again to exit)\ngobar > ls"},
+	}
+
+	for _, c := range cases {
+		screen := newVirtualScreen(40, 10)
+		console := NewConsole(strings.NewReader(c.keys), screen, screen.size)
+		input := console.GetUserInput([]PromptSegment{NewPromptSegment("gobar", "black", "white")},
+			NilTabComplete)
+		if got := screen.text(); input != c.input || got != c.text {
+			t.Errorf("GetUserInput(%q) = %q showing %q, want %q showing %q", c.keys,
+				input, got, c.input, c.text)
+		}
+	}
+}
+
+func TestScreenNotify(t *testing.T) {
+	defer screenTestSetup()()
+	prompts := []PromptSegment{NewPromptSegment("gobar", "black", "white")}
+
+	screen := newVirtualScreen(40, 10)
+	console := NewConsole(strings.NewReader(""), screen, screen.size)
+	console.showLine(commandLine{input: "ls -l", cursor: 2}, prompts, false)
+	console.Notify("new shell from 10.0.0.5")
+	console.Notify("listener stopped")
+
+	expected := "new shell from 10.0.0.5\nlistener stopped\ngobar > ls -l"
+	if got := screen.text(); got != expected {
+		t.Errorf("notifications showed %q, want %q", got, expected)
+	}
+	if screen.row != 2 || screen.col != len("gobar > ls") {
+		t.Errorf("cursor at %v,%v after notifying, want 2,%v", screen.row, screen.col,
+			len("gobar > ls"))
+	}
+}
+
+// After being continued the line is drawn again below the shell's messages,
+// which are left alone even when the line wrapped
+func TestScreenDrawLineAfresh(t *testing.T) {
+	defer screenTestSetup()()
+	prompts := []PromptSegment{NewPromptSegment("gobar", "black", "white")}
+	alphabet := "abcdefghijklmnopqrstuvwxyz"
+
+	screen := newVirtualScreen(20, 10)
+	console := NewConsole(strings.NewReader(""), screen, screen.size)
+	console.showLine(commandLine{input: alphabet, cursor: 26}, prompts, false)
+	screen.Write([]byte("\r\n[1]+ Stopped\r\n$ fg\r\n"))
+	console.mutex.Lock()
+	console.drawLineAfresh()
+	console.mutex.Unlock()
+
+	expected := "gobar > abcdefghijkl\nmnopqrstuvwxyz\n[1]+ Stopped\n$ fg\n" +
+		"gobar > abcdefghijkl\nmnopqrstuvwxyz"
+	if got := screen.text(); got != expected || screen.row != 5 || screen.col != 14 {
+		t.Errorf("line drawn after resuming as %q at %v,%v, want %q at 5,14", got,
+			screen.row, screen.col, expected)
+	}
+}
+
+func TestScreenNotifyWhileTyping(t *testing.T) {
+	defer screenTestSetup()()
+
+	keys, typing := io.Pipe()
+	screen := newVirtualScreen(40, 10)
+	console := NewConsole(keys, screen, screen.size)
+	done := make(chan string)
+	go func() {
+		done <- console.GetUserInput([]PromptSegment{NewPromptSegment("gobar", "", "")},
+			NilTabComplete)
+	}()
+
+	// Wait for the prompt, notifications before it are just printed
+	for editing := false; !editing; {
+		console.mutex.Lock()
+		editing = console.editing != nil
+		console.mutex.Unlock()
+	}
+	var notifiers sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		notifiers.Add(1)
+		go func(i int) {
+			defer notifiers.Done()
+			console.Notify(fmt.Sprintf("event %v", i))
+		}(i)
+	}
+	for _, key := range "ls" {
+		typing.Write([]byte(string(key)))
+	}
+	notifiers.Wait()
+	typing.Write([]byte("\r"))
+
+	if input := <-done; input != "ls" {
+		t.Errorf("input while notifying = %q, want %q", input, "ls")
+	}
+	rows := strings.Split(screen.text(), "\n")
+	if len(rows) != 4 || rows[3] != "gobar > ls" {
+		t.Fatalf("notifying while typing showed %q, want 3 events then the line", rows)
+	}
+	sort.Strings(rows[:3])
+	if strings.Join(rows[:3], "|") != "event 0|event 1|event 2" {
+		t.Errorf("events showed as %q", rows[:3])
+	}
+}
+
+// Keys typed by a user who then stops, so the screen can be looked at while
+// the line is still edited. waiting receives once every key was read, the
+// input then ends when stop is closed.
+type pausingKeys struct {
+	keys    *strings.Reader
+	waiting chan bool
+	stop    chan bool
+}
+
+func (keys *pausingKeys) Read(buf []byte) (int, error) {
+	if keys.keys.Len() > 0 {
+		return keys.keys.Read(buf)
+	}
+	keys.waiting <- true
+	<-keys.stop
+	return 0, io.EOF
+}
+
+// Type keys on a screen of the given width and return what it shows and
+// where the cursor is before the line is finished
+func pauseScreen(width int, keys string) (text string, row int, col int) {
+	screen := newVirtualScreen(width, 10)
+	input := &pausingKeys{strings.NewReader(keys), make(chan bool), make(chan bool)}
+	console := NewConsole(input, screen, screen.size)
+	done := make(chan bool)
+	go func() {
+		console.GetUserInput([]PromptSegment{NewPromptSegment("gobar", "", "")},
+			NilTabComplete)
+		done <- true
+	}()
+	<-input.waiting
+	text, row, col = screen.text(), screen.row, screen.col
+	close(input.stop)
+	<-done
+	return text, row, col
+}
+
+func TestScreenWrapping(t *testing.T) {
+	defer screenTestSetup()()
+	alphabet := "abcdefghijklmnopqrstuvwxyz"
+
+	cases := []struct {
+		keys string
+		text string
+		row  int
+		col  int
+	}{
+		{alphabet, "gobar > abcdefghijkl\nmnopqrstuvwxyz", 1, 14},
+		{alphabet + "\x7f", "gobar > abcdefghijkl\nmnopqrstuvwxy", 1, 13},
+		{alphabet + strings.Repeat("\x7f", 15), "gobar > abcdefghijk", 0, 19},
+		{alphabet + "\x01", "gobar > abcdefghijkl\nmnopqrstuvwxyz", 0, 8},
+		{alphabet + "\x01X", "gobar > Xabcdefghijk\nlmnopqrstuvwxyz", 0, 9},
+		{alphabet + "\x01\x05", "gobar > abcdefghijkl\nmnopqrstuvwxyz", 1, 14},
+		{alphabet + "\x01\x06\x06\x06\x06\x06\x06\x06\x06\x06\x06\x06\x06\x06\x7f",
+			"gobar > abcdefghijkl\nnopqrstuvwxyz", 1, 0},
+		{"abcdefghijkl", "gobar > abcdefghijkl", 1, 0},
+		{"abcdefghijkl\x7f", "gobar > abcdefghijk", 0, 19},
+		{alphabet + alphabet, "gobar > abcdefghijkl\nmnopqrstuvwxyzabcdef\nghijklmnopqrstuvwxyz",
+			3, 0},
+	}
+
+	for _, c := range cases {
+		got, row, col := pauseScreen(20, c.keys)
+		if got != c.text || row != c.row || col != c.col {
+			t.Errorf("typing %q at width 20 showed %q with the cursor at %v,%v, want %q at %v,%v",
+				c.keys, got, row, col, c.text, c.row, c.col)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// State of a reverse incremental history search (Ctrl + r)
+//
+//	query:    What the user typed so far
+//	match:    Index of the matching history item, -1 if nothing matched yet
+//	failed:   The last change to the query found nothing
+//	original: Line to restore when the search is cancelled
+type historySearch struct {
+	query    string
+	match    int
+	failed   bool
+	original commandLine
+}
+
+// Enter search mode, remembering the current line
+func (line *commandLine) startSearch() {
+	line.search = &historySearch{"", -1, false, *line}
+}
+
+// Look for the query in history, starting at 'start' and going back in time
+func (line *commandLine) updateSearch(start int) {
+	search := line.search
+	if search.query == "" {
+		// An empty query matches nothing, show the line as it was
+		search.match = -1
+		search.failed = false
+		line.input = search.original.input
+		line.cursor = search.original.cursor
+		return
+	}
+	history := line.editor().history
+	index := history.search(search.query, start)
+	if index == -1 {
+		search.failed = true
+		return
+	}
+	search.failed = false
+	search.match = index
+	line.input = history.commandHistory[index]
+	// Place the cursor on the matched text
+	offset := strings.Index(line.input, search.query)
+	line.cursor = utf8.RuneCountInString(line.input[:offset])
+}
+
+// Add a character to the query, narrowing the current match
+func (line *commandLine) searchAppend(r rune) {
+	line.search.query += string(r)
+	start := line.search.match
+	if start == -1 {
+		start = len(line.editor().history.commandHistory) - 1
+	}
+	line.updateSearch(start)
+}
+
+// Remove the last character of the query and search again from the newest item
+func (line *commandLine) searchBackspace() {
+	query := []rune(line.search.query)
+	if len(query) == 0 {
+		return
+	}
+	line.search.query = string(query[:len(query)-1])
+	line.updateSearch(len(line.editor().history.commandHistory) - 1)
+}
+
+// Move on to the next older match
+func (line *commandLine) searchOlder() {
+	start := line.search.match - 1
+	if line.search.match == -1 {
+		start = len(line.editor().history.commandHistory) - 1
+	}
+	if start < 0 {
+		line.search.failed = true
+		return
+	}
+	line.updateSearch(start)
+}
+
+// Keep the matched line and leave search mode
+func (line *commandLine) acceptSearch() {
+	if line.search.match != -1 {
+		// Pushing this line unedited will move the item to the end of history
+		line.editor().history.index = line.search.match
+	}
+	line.search = nil
+}
+
+// Leave search mode, putting back the line as it was before the search
+func (line *commandLine) cancelSearch() {
+	original := line.search.original
+	line.input = original.input
+	line.cursor = original.cursor
+	line.search = nil
+}
+
+// Handle a key while searching
+func (line *commandLine) handleSearchKey(event keyEvent) {
+	switch event.String() {
+	case "Enter":
+		line.acceptSearch()
+		line.done = true
+	case "C-r":
+		line.searchOlder()
+	case "C-g", "Esc":
+		line.cancelSearch()
+	case "Backspace":
+		line.searchBackspace()
+	case "Paste":
+		for _, r := range strings.Replace(event.text, "\n", " ", -1) {
+			line.searchAppend(r)
+		}
+	default:
+		if event.isChar() {
+			line.searchAppend(event.r)
+			return
+		}
+		// Any other key accepts the match and then acts on it
+		line.acceptSearch()
+		line.dispatchKeyEvent(event)
+	}
+}
+
+// The search prompt and the input, shown in place of the normal prompt
+func searchPrompt(line commandLine) string {
+	label := "reverse-i-search"
+	if line.search.failed {
+		label = "failed " + label
+	}
+	return fmt.Sprintf("(%v)`%v': %v", label, renderInput(line.search.query),
+		renderInput(line.input))
+}
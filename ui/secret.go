@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	Reading values that must not be seen, such as passwords and passphrases.
+	Secret input is never echoed, offered as a suggestion or written to the
+	history. It is held in a byte slice rather than a string so it can be
+	wiped: the caller owns the returned slice and should zero it when done,
+	for example with WipeSecret.
+
+	Commands can ask for a secret while they run, the terminal is switched
+	to raw mode for it and back again afterwards.
+*/
+
+const (
+	SecretMask   = "*" // Show a * for each character typed
+	SecretHidden = ""  // Show nothing at all
+)
+
+var (
+	ErrSecretCancelled = errors.New("Input cancelled")
+)
+
+func GetSecretInput(prompt string, mask string) ([]byte, error) {
+	return defaultConsole.GetSecretInput(prompt, mask)
+}
+
+// Prompt for a secret, showing mask for every character typed. Enter
+// finishes, C-c or Esc cancel with ErrSecretCancelled, the end of input
+// returns io.EOF.
+func (console *Console) GetSecretInput(prompt string, mask string) ([]byte, error) {
+	if !console.isPrepared() {
+		// Asked for by a command, put the terminal back for it afterwards
+		console.prepareKeyboard()
+		defer console.resetKeyboard()
+	}
+	secret := make([]byte, 0, 64)
+	keys := keyDecoder{raw: true}
+	defer func() {
+		// The decoder's buffer held the last characters typed or pasted
+		WipeSecret(keys.buf[:cap(keys.buf)])
+		keys.reset()
+	}()
+
+	console.drawSecret(prompt, mask, 0)
+	for {
+		timeout := time.Duration(0)
+		if keys.pending() {
+			timeout = escapeTimeout
+		}
+		input, ok, err := console.readByte(timeout)
+		if err != nil {
+			WipeSecret(secret)
+			console.write("\r\n")
+			return nil, err
+		}
+
+		var events []keyEvent
+		if ok {
+			events = keys.feed(input)
+		} else {
+			events = keys.flush()
+		}
+		for _, event := range events {
+			switch {
+			case event.isChar():
+				var encoded [utf8.UTFMax]byte
+				size := utf8.EncodeRune(encoded[:], event.r)
+				secret = appendSecret(secret, encoded[:size])
+			case event.key == "Paste":
+				secret = appendPasted(secret, event.data)
+			case event.String() == "Backspace" || event.String() == "C-h":
+				_, size := utf8.DecodeLastRune(secret)
+				WipeSecret(secret[len(secret)-size:])
+				secret = secret[:len(secret)-size]
+			case event.String() == "C-u":
+				WipeSecret(secret)
+				secret = secret[:0]
+			case event.String() == "Enter":
+				console.write("\r\n")
+				return secret, nil
+			case event.String() == "C-c" || event.String() == "Esc":
+				WipeSecret(secret)
+				console.write("\r\n")
+				return nil, ErrSecretCancelled
+			}
+		}
+		console.drawSecret(prompt, mask, utf8.RuneCount(secret))
+	}
+}
+
+// Overwrite a secret with zeros
+func WipeSecret(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
+
+// Append to a secret, wiping the old buffer if it has to grow
+func appendSecret(secret []byte, text []byte) []byte {
+	if len(secret)+len(text) > cap(secret) {
+		grown := make([]byte, len(secret), 2*cap(secret)+len(text))
+		copy(grown, secret)
+		WipeSecret(secret)
+		secret = grown
+	}
+	secret = append(secret, text...)
+	WipeSecret(text)
+	return secret
+}
+
+// Append pasted bytes to a secret, dropping line endings and other control
+// characters apart from tabs, as a Paste event's text would
+func appendPasted(secret []byte, pasted []byte) []byte {
+	for len(pasted) > 0 {
+		r, size := utf8.DecodeRune(pasted)
+		if r != utf8.RuneError && (!unicode.IsControl(r) || r == '\t') {
+			secret = appendSecret(secret, pasted[:size])
+		}
+		pasted = pasted[size:]
+	}
+	return secret
+}
+
+func (console *Console) drawSecret(prompt string, mask string, length int) {
+	console.write("\r" + ESCSEQ + "K" + prompt + strings.Repeat(mask, length))
+}
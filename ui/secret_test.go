@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSecretInput(t *testing.T) {
+	defer screenTestSetup()()
+
+	cases := []struct {
+		keys   string
+		mask   string
+		secret string
+		err    error
+		screen string
+	}{
+		{"hunter2\r", SecretMask, "hunter2", nil, "Password: *******"},
+		{"hunter2\r", SecretHidden, "hunter2", nil, "Password:"},
+		{"abc\x7fd\r", SecretMask, "abd", nil, "Password: ***"},
+		{"ab\x15cd\r", SecretMask, "cd", nil, "Password: **"},
+		{"\x7f\x7fx\r", SecretMask, "x", nil, "Password: *"},
+		{"pä日\r", SecretMask, "pä日", nil, "Password: ***"},
+		{PASTE_START + "pasted\n" + PASTE_END + "\r", SecretMask, "pasted", nil,
+			"Password: ******"},
+		{PASTE_START + "a\tb\r\nc\x01" + PASTE_END + "\r", SecretMask, "a\tbc", nil,
+			"Password: ****"},
+		{"secret\x03", SecretMask, "", ErrSecretCancelled, "Password: ******"},
+		{"secret", SecretMask, "", io.EOF, "Password: ******"},
+	}
+
+	for _, c := range cases {
+		screen := newVirtualScreen(40, 5)
+		console := NewConsole(strings.NewReader(c.keys), screen, screen.size)
+		secret, err := console.GetSecretInput("Password: ", c.mask)
+		if string(secret) != c.secret || err != c.err {
+			t.Errorf("GetSecretInput(%q) = %q, %v, want %q, %v", c.keys, secret, err,
+				c.secret, c.err)
+		}
+		if got := screen.text(); got != c.screen || screen.row != 1 || screen.col != 0 {
+			t.Errorf("screen after %q = %q at %v,%v, want %q at 1,0", c.keys, got,
+				screen.row, screen.col, c.screen)
+		}
+		if history := console.state.history.commandHistory; len(history) != 0 {
+			t.Errorf("GetSecretInput(%q) added to the history: %q", c.keys,
+				history)
+		}
+	}
+}
+
+func TestWipeSecret(t *testing.T) {
+	secret := make([]byte, 0, 2)
+	old := secret[:2]
+	secret = appendSecret(secret, []byte("ab"))
+	secret = appendSecret(secret, []byte("cd"))
+	if string(secret) != "abcd" {
+		t.Errorf("appendSecret = %q, want %q", secret, "abcd")
+	}
+	if old[0] != 0 || old[1] != 0 {
+		t.Errorf("appendSecret left %q in the old buffer", old)
+	}
+	WipeSecret(secret)
+	if string(secret) != "\x00\x00\x00\x00" {
+		t.Errorf("WipeSecret left %q", secret)
+	}
+}
+
+// A raw decoder doesn't copy characters or pastes into strings
+func TestRawKeyDecoder(t *testing.T) {
+	keys := keyDecoder{raw: true}
+	var events []keyEvent
+	for _, b := range []byte("aé" + PASTE_START + "pw" + PASTE_END) {
+		for _, event := range keys.feed(b) {
+			if event.key == "Paste" {
+				if string(event.data) != "pw" || event.text != "" {
+					t.Errorf("paste = %q, %q, want data %q", event.data, event.text, "pw")
+				}
+			}
+			events = append(events, event)
+		}
+	}
+	if len(events) != 3 || events[0].r != 'a' || events[1].r != 'é' {
+		t.Fatalf("raw decoder events = %+v", events)
+	}
+	for _, event := range events[:2] {
+		if event.key != "" || !event.isChar() {
+			t.Errorf("raw character event = %+v, want r without key", event)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package ui
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Prompt segments whose text is worked out every time the prompt is shown,
+	such as the time or the current directory. The provider runs in the
+	background and the prompt waits for it for at most its timeout, after
+	that the last text it gave is shown. A provider is not run again until
+	its text is older than the cache time. Providers are asked once when the
+	prompt is shown, redrawing the line while it is edited reuses their text.
+	Segments with no text are left out of the prompt.
+*/
+
+const (
+	defaultSegmentTimeout = 50 * time.Millisecond
+)
+
+var (
+	// Exit status of the last command, 0 if it succeeded
+	lastStatus = 0
+	// How long the last command took
+	lastDuration time.Duration
+	// A command has been run, so lastStatus and lastDuration mean something
+	commandRun = false
+
+	// Name prefixes of network interfaces that VPNs usually create
+	vpnInterfaces = []string{"tun", "tap", "wg", "ppp", "utun", "ipsec"}
+)
+
+// Source of a segment's text, with the text it last gave
+//
+//	provide: Returns the current text, given the last command's exit status
+//	timeout: How long the prompt waits for provide
+//	ttl:     How long the text is shown before provide is asked again
+//	result:  Receives the text of the provider running, nil if it is not
+type segmentProvider struct {
+	provide func(status int) string
+	timeout time.Duration
+	ttl     time.Duration
+
+	mutex   sync.Mutex
+	text    string
+	updated time.Time
+	result  chan string
+}
+
+// Create a segment whose text comes from provide. The prompt waits at most
+// timeout for it, and its text is reused for ttl before provide is called
+// again.
+func NewDynamicSegment(provide func() string, fgcolor, bgcolor string,
+	timeout, ttl time.Duration) PromptSegment {
+
+	checkSegmentColors(fgcolor, bgcolor)
+	provider := &segmentProvider{
+		provide: func(int) string { return provide() },
+		timeout: timeout,
+		ttl:     ttl,
+	}
+	return PromptSegment{Fgcolor: fgcolor, Bgcolor: bgcolor, provider: provider}
+}
+
+// A segment drawn in a style of the theme, whose text comes from provide
+func newStyledDynamicSegment(provide func(status int) string, style string,
+	ttl time.Duration) PromptSegment {
+
+	provider := &segmentProvider{provide: provide, timeout: defaultSegmentTimeout, ttl: ttl}
+	return PromptSegment{Style: style, provider: provider}
+}
+
+// The time, updated every second
+func ClockSegment() PromptSegment {
+	return newStyledDynamicSegment(func(int) string {
+		return time.Now().Format("15:04:05")
+	}, "clock", time.Second)
+}
+
+// The current directory, with the home directory shown as ~
+func DirectorySegment() PromptSegment {
+	return newStyledDynamicSegment(func(int) string {
+		return currentDirectory()
+	}, "directory", 0)
+}
+
+// Exit status of the last command, hidden when it succeeded
+func StatusSegment() PromptSegment {
+	return newStyledDynamicSegment(func(status int) string {
+		if status == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%v %v", currentTheme.fail, status)
+	}, "status", 0)
+}
+
+// Address of the first VPN interface that is up, hidden when there is none
+func VPNSegment() PromptSegment {
+	return newStyledDynamicSegment(func(int) string {
+		return vpnAddress()
+	}, "vpn", 5*time.Second)
+}
+
+// Number of sessions or listeners, as returned by count, hidden when there
+// are none
+func SessionsSegment(label string, count func() int) PromptSegment {
+	return newStyledDynamicSegment(func(int) string {
+		if n := count(); n > 0 {
+			return fmt.Sprintf("%v %v", n, label)
+		}
+		return ""
+	}, "sessions", time.Second)
+}
+
+// Text of a segment, asking its provider if it has one. status is the exit
+// status of the last command.
+func (segment PromptSegment) text(status int) string {
+	if segment.provider == nil {
+		return segment.Text
+	}
+	return segment.provider.get(status)
+}
+
+// The segments with the text their providers give now, which is kept while
+// the line is redrawn. Call from the goroutine running the commands, which
+// is the one setting the last status.
+func resolveSegments(segments []PromptSegment) []PromptSegment {
+	resolved := make([]PromptSegment, 0, len(segments))
+	for _, segment := range segments {
+		segment.Text = segment.text(lastStatus)
+		segment.provider = nil
+		resolved = append(resolved, segment)
+	}
+	return resolved
+}
+
+// The provider's text, from the cache if it is recent enough. If the
+// provider takes longer than its timeout the previous text is returned and
+// the new one is cached once it arrives, until then the prompt does not wait
+// for it again.
+func (provider *segmentProvider) get(status int) string {
+	provider.mutex.Lock()
+	if !provider.updated.IsZero() && time.Since(provider.updated) < provider.ttl {
+		defer provider.mutex.Unlock()
+		return provider.text
+	}
+	if provider.result != nil {
+		// Still running after an earlier timeout, don't wait for it again
+		defer provider.mutex.Unlock()
+		return provider.text
+	}
+	result := make(chan string, 1)
+	provider.result = result
+	provider.mutex.Unlock()
+
+	go func() {
+		text := provider.provide(status)
+		provider.mutex.Lock()
+		provider.text = text
+		provider.updated = time.Now()
+		provider.result = nil
+		provider.mutex.Unlock()
+		result <- text
+	}()
+
+	select {
+	case text := <-result:
+		return text
+	case <-time.After(provider.timeout):
+		provider.mutex.Lock()
+		defer provider.mutex.Unlock()
+		return provider.text
+	}
+}
+
+// Record how the last command went, for StatusSegment and the right prompt
+func setLastStatus(err error, duration time.Duration) {
+	commandRun = true
+	lastDuration = duration
+	switch err := err.(type) {
+	case nil:
+		lastStatus = 0
+	case *exec.ExitError:
+		lastStatus = err.ExitCode()
+		if lastStatus < 0 {
+			lastStatus = 1 // killed by a signal
+		}
+	default:
+		lastStatus = 1
+	}
+}
+
+func currentDirectory() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	home := os.Getenv("HOME")
+	if home != "" && (dir == home || strings.HasPrefix(dir, home+"/")) {
+		return "~" + dir[len(home):]
+	}
+	return dir
+}
+
+func vpnAddress() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || !isVPNInterface(iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ip, ok := addr.(*net.IPNet); ok && ip.IP.To4() != nil {
+				return ip.IP.String()
+			}
+		}
+	}
+	return ""
+}
+
+func isVPNInterface(name string) bool {
+	for _, prefix := range vpnInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
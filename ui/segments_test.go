@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSegmentProvider(t *testing.T) {
+	calls := 0
+	segment := NewDynamicSegment(func() string {
+		calls++
+		return string(rune('a' + calls - 1))
+	}, "", "", time.Second, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if got := segment.text(0); got != "a" || calls != 1 {
+			t.Errorf("cached text = %q after %v calls, want %q after 1", got, calls, "a")
+		}
+	}
+	segment.provider.ttl = 0
+	if got := segment.text(0); got != "b" || calls != 2 {
+		t.Errorf("expired text = %q after %v calls, want %q after 2", got, calls, "b")
+	}
+}
+
+func TestSegmentTimeout(t *testing.T) {
+	release := make(chan string)
+	segment := NewDynamicSegment(func() string {
+		return <-release
+	}, "", "", 50*time.Millisecond, 0)
+	running := func() bool {
+		segment.provider.mutex.Lock()
+		defer segment.provider.mutex.Unlock()
+		return segment.provider.result != nil
+	}
+
+	// Nothing cached yet, the segment is left out
+	if got := segment.text(0); got != "" {
+		t.Errorf("slow provider gave %q, want nothing", got)
+	}
+	// The slow provider is still running, no waiting for it again
+	start := time.Now()
+	if got := segment.text(0); got != "" || time.Since(start) > 25*time.Millisecond {
+		t.Errorf("second call gave %q after %v, want nothing at once", got,
+			time.Since(start))
+	}
+	release <- "old"
+	for running() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := segment.text(0); got != "old" {
+		t.Errorf("after timing out again got %q, want the cached %q", got, "old")
+	}
+	release <- "new"
+}
+
+func TestDisplayDynamicPrompt(t *testing.T) {
+	defer func(saved int) { lastStatus = saved }(lastStatus)
+	segments := []PromptSegment{StatusSegment(), NewPromptSegment("gobar", "", "")}
+	defer func(saved string) { *prompt_end = saved }(*prompt_end)
+	*prompt_end = ">"
+
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{nil, "gobar > "},
+		{errors.New("failed"), "✘ 1 gobar > "},
+		{exec.Command("sh", "-c", "exit 3").Run(), "✘ 3 gobar > "},
+	}
+
+	for _, c := range cases {
+		setLastStatus(c.err, 0)
+		out := &bytes.Buffer{}
+		NewConsole(nil, out, nil).DisplayPrompt(segments)
+		if got := out.String(); got != c.expected {
+			t.Errorf("prompt after %v = %q, want %q", c.err, got, c.expected)
+		}
+	}
+}
+
+func TestCurrentDirectory(t *testing.T) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	dir, _ := os.Getwd()
+
+	os.Setenv("HOME", dir)
+	if got := currentDirectory(); got != "~" {
+		t.Errorf("currentDirectory() in HOME = %q, want %q", got, "~")
+	}
+	os.Setenv("HOME", dir+"x")
+	if got := currentDirectory(); got != dir {
+		t.Errorf("currentDirectory() = %q, want %q", got, dir)
+	}
+}
+
+func TestSessionsSegment(t *testing.T) {
+	count := 0
+	segment := SessionsSegment("shells", func() int { return count })
+	if got := segment.text(0); got != "" {
+		t.Errorf("no sessions shows %q, want nothing", got)
+	}
+	segment.provider.ttl = 0
+	count = 2
+	if got := segment.text(0); got != "2 shells" {
+		t.Errorf("two sessions show %q, want %q", got, "2 shells")
+	}
+}
+
+func TestSegmentsResolvedOncePerLine(t *testing.T) {
+	defer screenTestSetup()()
+	calls := 0
+	segment := NewDynamicSegment(func() string {
+		calls++
+		return "dir"
+	}, "", "", time.Second, 0)
+
+	screen := newVirtualScreen(40, 10)
+	console := NewConsole(strings.NewReader("ls -la\x02\x02\n"), screen, screen.size)
+	console.GetUserInput([]PromptSegment{segment}, NilTabComplete)
+	if got := screen.text(); got != "dir > ls -la" || calls != 1 {
+		t.Errorf("screen = %q after %v calls, want %q after 1", got, calls, "dir > ls -la")
+	}
+}
+
+func TestStatusSegment(t *testing.T) {
+	segment := StatusSegment()
+	if got := segment.text(0); got != "" {
+		t.Errorf("status 0 shows %q, want nothing", got)
+	}
+	if got := segment.text(3); got != "✘ 3" {
+		t.Errorf("status 3 shows %q, want %q", got, "✘ 3")
+	}
+}
@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"github.com/fatih/color"
+	"strings"
+)
+
+/*
+	Inline suggestions, shown in dim text after the cursor while typing at the
+	end of the line. Right or End accepts the whole suggestion, Alt + f one
+	word of it.
+
+	Suggestions come from sources, functions that are given the input and
+	return a complete line starting with it, or "" if they have nothing to
+	offer. Sources registered with RegisterSuggestSource are asked newest
+	first, the console's command history is asked last.
+*/
+
+var (
+	suggestEnabled = true
+	suggestSources = []func(string) string{}
+
+	dim = color.New(color.Faint).SprintFunc()
+)
+
+// Add a source of suggestions, asked before the sources already registered
+func RegisterSuggestSource(source func(input string) string) {
+	suggestSources = append([]func(string) string{source}, suggestSources...)
+}
+
+func registerSuggestOptions() {
+	RegisterBoolOption("suggest", "Suggest how to finish the line, on or off",
+		&suggestEnabled)
+}
+
+// The newest history item that starts with the input
+func (hist *history) suggestion(input string) string {
+	items := hist.commandHistory
+	for i := len(items) - 1; i >= 0; i-- {
+		if strings.HasPrefix(items[i], input) {
+			return items[i]
+		}
+	}
+	return ""
+}
+
+// Ask the sources for a suggestion, only when the cursor is at the end of a
+// line that is still being edited
+func (line *commandLine) updateSuggestion() {
+	line.suggestion = ""
+	if !suggestEnabled || line.done || line.search != nil || line.menu != nil ||
+		len(line.input) == 0 || line.cursor != line.length() {
+		return
+	}
+	sources := make([]func(string) string, 0, len(suggestSources)+1)
+	sources = append(sources, suggestSources...)
+	sources = append(sources, line.editor().history.suggestion)
+	for _, source := range sources {
+		suggested := source(line.input)
+		if len(suggested) > len(line.input) && strings.HasPrefix(suggested, line.input) {
+			line.suggestion = suggested[len(line.input):]
+			return
+		}
+	}
+}
+
+// Move the first count runes of the suggestion into the input, or all of it
+// if count is negative
+func (line *commandLine) acceptSuggestion(count int) {
+	accepted := []rune(line.suggestion)
+	if count >= 0 && count < len(accepted) {
+		accepted = accepted[:count]
+	}
+	line.insertText(string(accepted))
+	line.suggestion = ""
+}
+
+// Number of runes in the first word of the suggestion
+func (line *commandLine) suggestedWord() int {
+	return wordEnd([]rune(line.suggestion), 0)
+}
@@ -0,0 +1,64 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSuggestions(t *testing.T) {
+	defer withHistory("ls /tmp", "cat /etc/passwd", "ls -la /var/log")()
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys       string
+		expected   string
+		cursor     int
+		suggestion string
+	}{
+		{"", "", 0, ""},
+		{"l", "l", 1, "s -la /var/log"},
+		{"ls /", "ls /", 4, "tmp"},
+		{"c", "c", 1, "at /etc/passwd"},
+		{"x", "x", 1, ""},
+		{"ls -la /var/log", "ls -la /var/log", 15, ""},
+		{"l" + RIGHT, "ls -la /var/log", 15, ""},
+		{"l\x05", "ls -la /var/log", 15, ""},
+		{"l\x1bf", "ls", 2, " -la /var/log"},
+		{"l\x1bf\x1bf", "ls -la", 6, " /var/log"},
+		{"ls\x02", "ls", 1, ""},
+		{"ls\x02" + RIGHT, "ls", 2, " -la /var/log"},
+		{"c\x06\x1f", "c", 1, "at /etc/passwd"},
+		{"c\n", "c", 1, ""},
+	}
+
+	for _, c := range cases {
+		line := newLine()
+		typeKeys(&line, c.keys, tc)
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("suggest %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+		if line.suggestion != c.suggestion {
+			t.Errorf("suggest %q suggested %q, want %q",
+				c.keys, line.suggestion, c.suggestion)
+		}
+	}
+
+	// Sources registered later are asked first
+	defer func(sources []func(string) string) { suggestSources = sources }(suggestSources)
+	RegisterSuggestSource(func(input string) string {
+		if strings.HasPrefix("chargen", input) {
+			return "chargen"
+		}
+		return ""
+	})
+	line := newLine()
+	typeKeys(&line, "c", tc)
+	if line.suggestion != "hargen" {
+		t.Errorf("registered source suggested %q, want %q", line.suggestion, "hargen")
+	}
+	typeKeys(&line, "a", tc)
+	if line.suggestion != "t /etc/passwd" {
+		t.Errorf("history suggested %q, want %q", line.suggestion, "t /etc/passwd")
+	}
+}
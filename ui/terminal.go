@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+/*
+	Terminal mode handling. The original termios state of stdin is saved
+	before switching to raw mode, and is put back on Exit, on panic (through
+	RestoreTerminal), when a fatal signal arrives and when gobar is suspended
+	with Ctrl+Z. When it is continued, raw mode is entered again and the line
+	being edited is redrawn.
+
+	SIGINT is never fatal. While a line is edited Ctrl+C is read as a key,
+	while a command runs the terminal is in its original mode and Ctrl+C
+	interrupts only the command.
+*/
+
+var (
+	origTermios    *syscall.Termios
+	handlingSignal = false
+)
+
+// Read the termios state of a file descriptor
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	termios := new(syscall.Termios)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios,
+		uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return nil, errno
+	}
+	return termios, nil
+}
+
+// Apply a termios state to a file descriptor
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios,
+		uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Size of a terminal, as returned by TIOCGWINSZ
+type winsize struct {
+	rows    uint16
+	columns uint16
+	xpixel  uint16
+	ypixel  uint16
+}
+
+// Size of the terminal on stdout, 80x24 if it is not a terminal
+func stdoutSize() (columns int, rows int) {
+	var size winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(),
+		syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 || size.columns == 0 {
+		return 80, 24
+	}
+	return int(size.columns), int(size.rows)
+}
+
+// Is the file descriptor connected to a terminal
+func isTerminal(fd uintptr) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// Disables echo, disables newline buffering and makes Ctrl+C a key rather
+// than SIGINT. The original state is saved so
+// it can be restored later. Fails if stdin is not a terminal.
+func enableRawMode() error {
+	fd := os.Stdin.Fd()
+	termios, err := getTermios(fd)
+	if err != nil {
+		return err
+	}
+	if origTermios == nil {
+		saved := *termios
+		origTermios = &saved
+	}
+
+	raw := *termios
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN
+	raw.Cc[syscall.VINTR] = vdisable
+	raw.Iflag &^= syscall.IXON
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	return setTermios(fd, &raw)
+}
+
+// Puts back the terminal state saved by enableRawMode
+func disableRawMode() error {
+	if origTermios == nil {
+		return nil
+	}
+	return setTermios(os.Stdin.Fd(), origTermios)
+}
+
+// Read a single byte from stdin. With a timeout and a terminal on stdin, the
+// read gives up after that long and ok is false.
+func readTerminalByte(timeout time.Duration) (input byte, ok bool, err error) {
+	buf := make([]byte, 1)
+	fd := os.Stdin.Fd()
+	termios, terr := getTermios(fd)
+	if timeout <= 0 || terr != nil {
+		if _, err := io.ReadFull(os.Stdin, buf); err != nil {
+			return 0, false, err
+		}
+		return buf[0], true, nil
+	}
+
+	// Let the terminal driver time the read, in tenths of a second
+	tenths := (timeout + 99*time.Millisecond) / (100 * time.Millisecond)
+	if tenths > 255 {
+		tenths = 255
+	}
+	timed := *termios
+	timed.Cc[syscall.VMIN] = 0
+	timed.Cc[syscall.VTIME] = uint8(tenths)
+	if err := setTermios(fd, &timed); err != nil {
+		return 0, false, err
+	}
+	defer setTermios(fd, termios)
+
+	for {
+		n, err := syscall.Read(int(fd), buf)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return 0, false, err
+		}
+		return buf[0], n == 1, nil
+	}
+}
+
+// Interrupt the running command on SIGINT, suspend and continue on SIGTSTP
+// and SIGCONT. Restore the terminal on fatal
+// signals, then let the signal take its default action so the exit status
+// is preserved.
+func handleSignals() {
+	if handlingSignal {
+		return
+	}
+	handlingSignal = true
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, syscall.SIGINT)
+	go func() {
+		for range interrupts {
+			interruptCommand()
+		}
+	}()
+
+	stops := make(chan os.Signal, 1)
+	signal.Notify(stops, syscall.SIGTSTP, syscall.SIGCONT)
+	go func() {
+		for sig := range stops {
+			if sig == syscall.SIGTSTP {
+				defaultConsole.suspend()
+			} else {
+				defaultConsole.resume()
+			}
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	go func() {
+		sig := <-sigs
+		defaultConsole.disablePaste()
+		disableRawMode()
+		defaultConsole.write("\n")
+		signal.Reset(sig)
+		syscall.Kill(os.Getpid(), sig.(syscall.Signal))
+	}()
+}
+
+// Put the terminal back the way it was and stop. SIGSTOP is used as it can
+// not be caught, the caught SIGTSTP would just come back.
+func (console *Console) suspend() {
+	console.mutex.Lock()
+	if console.prepared && console.isTerminal() {
+		if console.paste {
+			console.print(PASTE_OFF)
+		}
+		disableRawMode()
+	}
+	console.mutex.Unlock()
+	syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+}
+
+// Set the terminal up again after being continued, the shell gobar was
+// started from may have changed it, and redraw the line being edited
+func (console *Console) resume() {
+	console.mutex.Lock()
+	if !console.prepared || !console.isTerminal() {
+		console.mutex.Unlock()
+		return
+	}
+	err := enableRawMode()
+	if console.paste {
+		console.print(PASTE_ON)
+	}
+	console.drawLineAfresh()
+	// Warnings are drawn above the line, which takes the mutex
+	console.mutex.Unlock()
+	if err != nil {
+		warning("Unable to set terminal mode: %v", err)
+	}
+}
+
+// Draw the line being edited again from the start of the cursor's row. The
+// shell has printed its job control messages since the line was drawn, so
+// it is not cleared first. Call with the mutex held.
+func (console *Console) drawLineAfresh() {
+	if console.editing == nil {
+		return
+	}
+	console.row, console.rows = 0, 1
+	console.print("\r")
+	console.drawLine(*console.editing, console.prompts)
+}
+
+// Put the terminal back into the state it was in before gobar started. Safe
+// to call multiple times, intended to be deferred from main so a panic does
+// not leave the terminal without echo.
+func RestoreTerminal() {
+	defaultConsole.disablePaste()
+	disableRawMode()
+}
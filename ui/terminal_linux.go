@@ -0,0 +1,9 @@
+package ui
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+	vdisable        = 0 // Control character value that turns it off
+)
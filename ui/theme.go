@@ -0,0 +1,246 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+	Prompt themes. A theme holds the separators drawn between and after the
+	prompt segments and named styles that segments, error messages and output
+	are drawn in. A style is 'fg' or 'fg on bg', each as understood by
+	colorize, e.g. 'bold white on #005f87'.
+
+	Themes are defined in sections of the configuration file named
+	[theme <name>], and start out as a copy of the powerline theme:
+
+		[theme dark]
+		end = >
+		mid = " | "
+		prompt = white on 236
+		error = bold red
+
+	end is drawn after the last segment and mid between the others, ok and
+	fail mark commands that succeeded and failed. Any of them may be quoted to
+	keep spaces. The styles used by gobar are prompt, error, output, status,
+	vpn, clock, directory, sessions, in vi mode normal and insert, and in the
+	right prompt duration, success, failure and time.
+*/
+
+// Colours of a style
+type segmentStyle struct {
+	fg string
+	bg string
+}
+
+// Separators, markers and styles of a theme
+//
+//	end:  Drawn after the last prompt segment
+//	mid:  Drawn between prompt segments
+//	ok:   Marks a command that succeeded
+//	fail: Marks a command that failed
+type theme struct {
+	end    string
+	mid    string
+	ok     string
+	fail   string
+	styles map[string]segmentStyle
+}
+
+var (
+	themes = map[string]*theme{
+		"powerline": {"\ue0b0", " ", "✔", "✘", map[string]segmentStyle{
+			"prompt":    {"black", "white"},
+			"error":     {"black", "red"},
+			"output":    {"white", "black"},
+			"status":    {"white", "red"},
+			"vpn":       {"black", "cyan"},
+			"clock":     {"white", "blue"},
+			"directory": {"black", "yellow"},
+			"sessions":  {"black", "green"},
+			"normal":    {"black", "yellow"},
+			"insert":    {"black", "green"},
+			"duration":  {"yellow", ""},
+			"success":   {"green", ""},
+			"failure":   {"red", ""},
+			"time":      {"", ""},
+		}},
+		"ascii": {">", " | ", "ok", "x", map[string]segmentStyle{
+			"prompt":    {"bold", ""},
+			"error":     {"bold red", ""},
+			"output":    {"", ""},
+			"status":    {"red", ""},
+			"vpn":       {"cyan", ""},
+			"clock":     {"", ""},
+			"directory": {"blue", ""},
+			"sessions":  {"green", ""},
+			"normal":    {"yellow", ""},
+			"insert":    {"green", ""},
+			"duration":  {"yellow", ""},
+			"success":   {"green", ""},
+			"failure":   {"bold red", ""},
+			"time":      {"", ""},
+		}},
+	}
+
+	currentTheme = themes["powerline"]
+
+	// Styles a theme can set, those used by gobar
+	themeStyleNames = []string{"prompt", "error", "output", "status", "vpn",
+		"clock", "directory", "sessions", "normal", "insert", "duration",
+		"success", "failure", "time"}
+)
+
+func registerThemeOptions() {
+	RegisterOption("theme", "Prompt theme, the 'theme' command lists them",
+		"powerline", setTheme)
+	RegisterConfigFamily("theme", setThemeValue)
+}
+
+// Switch to a theme, for the theme option
+func setTheme(name string) error {
+	selected, ok := themes[name]
+	if !ok {
+		return errors.New(fmt.Sprintf("Theme '%v' not found", name))
+	}
+	currentTheme = selected
+	return nil
+}
+
+// Set the separators or a style of a theme, creating it if needed
+func setThemeValue(name string, key string, value string) error {
+	if !isThemeKey(key) {
+		return errors.New(fmt.Sprintf("Unknown theme key '%v'", key))
+	}
+	selected, ok := themes[name]
+	if !ok {
+		selected = copyTheme(themes["powerline"])
+		themes[name] = selected
+	}
+
+	switch key {
+	case "end":
+		selected.end = unquoteValue(value)
+	case "mid":
+		selected.mid = unquoteValue(value)
+	case "ok":
+		selected.ok = unquoteValue(value)
+	case "fail":
+		selected.fail = unquoteValue(value)
+	default:
+		style, err := parseSegmentStyle(value)
+		if err != nil {
+			return err
+		}
+		selected.styles[key] = style
+	}
+	return nil
+}
+
+// Is key a separator, marker or style a theme can set
+func isThemeKey(key string) bool {
+	switch key {
+	case "end", "mid", "ok", "fail":
+		return true
+	}
+	for _, name := range themeStyleNames {
+		if key == name {
+			return true
+		}
+	}
+	return false
+}
+
+func copyTheme(source *theme) *theme {
+	copied := &theme{source.end, source.mid, source.ok, source.fail,
+		make(map[string]segmentStyle)}
+	for name, style := range source.styles {
+		copied.styles[name] = style
+	}
+	return copied
+}
+
+// Parse 'fg' or 'fg on bg'
+func parseSegmentStyle(value string) (segmentStyle, error) {
+	var style segmentStyle
+	fields := strings.Fields(value)
+	for i, field := range fields {
+		if field == "on" {
+			style.bg = strings.Join(fields[i+1:], " ")
+			fields = fields[:i]
+			break
+		}
+	}
+	style.fg = strings.Join(fields, " ")
+	for _, colours := range []string{style.fg, style.bg} {
+		if err := CheckColor(colours); err != nil {
+			return style, err
+		}
+	}
+	return style, nil
+}
+
+// Remove the double quotes around a value, if it has them
+func unquoteValue(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// The colours of a style of the current theme. ok is false if the theme
+// does not have it.
+func themeStyle(name string) (fg string, bg string, ok bool) {
+	style, ok := currentTheme.styles[name]
+	return style.fg, style.bg, ok
+}
+
+// Separators of the current theme, unless they were given as flags
+func themeSeparators() (end string, mid string) {
+	end, mid = currentTheme.end, currentTheme.mid
+	if *prompt_end != "" {
+		end = *prompt_end
+	}
+	if *prompt_mid != "" {
+		mid = *prompt_mid
+	}
+	return end, mid
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name, _ := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List the themes, or switch to one
+func themeCommand(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		output := "Themes:"
+		for _, name := range themeNames() {
+			marker := " "
+			if themes[name] == currentTheme {
+				marker = "*"
+			}
+			output += fmt.Sprintf("\n\t%v %v", marker, name)
+		}
+		return output, nil
+	}
+	if err := SetOption("theme", args[0]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Theme set to %v", args[0]), nil
+}
+
+func themeTabComplete(input string, cursor int) []Candidate {
+	if strings.Contains(string([]rune(input)[:cursor]), " ") {
+		return nil
+	}
+	return completeWords(input, cursor, themeNames(), nil)
+}
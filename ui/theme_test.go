@@ -0,0 +1,117 @@
+package ui
+
+import (
+	"github.com/fatih/color"
+	"testing"
+)
+
+func TestThemeConfig(t *testing.T) {
+	defer func(saved *theme) { currentTheme = saved }(currentTheme)
+	defer delete(themes, "test")
+
+	cases := []struct {
+		key     string
+		value   string
+		isError bool
+	}{
+		{"end", `">"`, false},
+		{"mid", `" | "`, false},
+		{"prompt", "bold white on 24", false},
+		{"error", "red", false},
+		{"output", "on #303030", false},
+		{"status", "purple on red", true},
+		{"vpn", "red on blue green", true},
+		{"ok", "yes", false},
+		{"prompts", "red", true},
+		{"colour", "red", true},
+	}
+	for _, c := range cases {
+		err := setThemeValue("test", c.key, c.value)
+		if (err != nil) != c.isError {
+			t.Errorf("setThemeValue(%q, %q) = %v, want error %v", c.key, c.value, err,
+				c.isError)
+		}
+	}
+
+	test := themes["test"]
+	if test.end != ">" || test.mid != " | " {
+		t.Errorf("separators = %q, %q, want %q, %q", test.end, test.mid, ">", " | ")
+	}
+	expected := map[string]segmentStyle{
+		"prompt": {"bold white", "24"},
+		"error":  {"red", ""},
+		"output": {"", "#303030"},
+		"status": themes["powerline"].styles["status"],
+	}
+	for name, style := range expected {
+		if test.styles[name] != style {
+			t.Errorf("style %v = %+v, want %+v", name, test.styles[name], style)
+		}
+	}
+	if _, ok := test.styles["prompts"]; ok {
+		t.Errorf("unknown style key was added to the theme")
+	}
+	if themes["powerline"].end == ">" {
+		t.Errorf("changing a new theme changed powerline")
+	}
+}
+
+func TestRenderThemedSegments(t *testing.T) {
+	defer func(saved bool) { color.NoColor = saved }(color.NoColor)
+	defer func(saved *theme) { currentTheme = saved }(currentTheme)
+	color.NoColor = false
+
+	segments := []PromptSegment{NewStyledSegment("vpn", "vpn"),
+		NewStyledSegment("gobar", "prompt"), NewStyledSegment("x", "nosuchstyle")}
+	cases := []struct {
+		theme    string
+		override string
+		expected string
+	}{
+		{"ascii", "", "\x1b[36mvpn | \x1b[0m\x1b[1mgobar | \x1b[0mx > "},
+		{"powerline", "",
+			"\x1b[30;46mvpn \x1b[0m\x1b[30;47mgobar \x1b[0mx  "},
+		{"ascii", "error",
+			"\x1b[1;31mvpn | \x1b[0m\x1b[1;31mgobar | \x1b[0m\x1b[1;31mx \x1b[0m\x1b[1;31m>\x1b[0m "},
+	}
+
+	for _, c := range cases {
+		setTheme(c.theme)
+		if got := renderPrompt(segments, c.override); got != c.expected {
+			t.Errorf("%v prompt = %q, want %q", c.theme, got, c.expected)
+		}
+	}
+}
+
+func TestThemeCommand(t *testing.T) {
+	defer func(saved *theme) { currentTheme = saved }(currentTheme)
+	RegisterOption("theme", "", "powerline", setTheme)
+	defer delete(options, "theme")
+
+	if _, err := themeCommand("nosuchtheme"); err == nil {
+		t.Errorf("theme nosuchtheme did not fail")
+	}
+	if _, err := themeCommand("ascii"); err != nil || currentTheme != themes["ascii"] ||
+		GetOption("theme") != "ascii" {
+		t.Errorf("theme ascii = %v, theme option %q", err, GetOption("theme"))
+	}
+	expected := "Themes:\n\t* ascii\n\t  powerline"
+	if got, _ := themeCommand(""); got != expected {
+		t.Errorf("theme = %q, want %q", got, expected)
+	}
+}
+
+// Every style the themes define can be set
+func TestThemeStyleNames(t *testing.T) {
+	for name, theme := range themes {
+		for style, _ := range theme.styles {
+			if !isThemeKey(style) {
+				t.Errorf("style %v of theme %v is not a theme key", style, name)
+			}
+		}
+		if len(theme.styles) != len(themeStyleNames) {
+			t.Errorf("theme %v has %v styles, want %v", name, len(theme.styles),
+				len(themeStyleNames))
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ui
+
+/*
+	Undo and redo for the line being edited. Every key that changes the input
+	pushes the state from before it onto the undo stack, so history recall,
+	completion, kills and yanks can all be undone. Characters typed one after
+	another are grouped into a single step, as is cycling through a completion
+	menu, and a whole reverse search counts as one step once it is accepted.
+*/
+
+// What undo puts back: the input and where the cursor was
+type lineState struct {
+	input  string
+	cursor int
+}
+
+func (line *commandLine) state() lineState {
+	return lineState{line.input, line.cursor}
+}
+
+func (line *commandLine) restore(state lineState) {
+	line.input = state.input
+	line.cursor = state.cursor
+}
+
+// Remember the state from before the last key if the key changed the input.
+// previous is the action of the key before it.
+func (line *commandLine) recordUndo(before lineState, previous string) {
+	if before.input == line.input || isUndoAction(line.lastAction) {
+		return
+	}
+	line.redoStack = nil
+	typing := line.lastAction == "self-insert" && previous == "self-insert"
+	cycling := isCompleteAction(line.lastAction) && isCompleteAction(previous) &&
+		line.menu != nil && before != line.menu.original
+	if (typing || cycling) && len(line.undoStack) > 0 {
+		// Part of the same step
+		return
+	}
+	line.undoStack = append(line.undoStack, before)
+}
+
+func isUndoAction(action string) bool {
+	return action == "undo" || action == "redo"
+}
+
+func undo(line *commandLine) {
+	if len(line.undoStack) == 0 {
+		return
+	}
+	last := len(line.undoStack) - 1
+	line.redoStack = append(line.redoStack, line.state())
+	line.restore(line.undoStack[last])
+	line.undoStack = line.undoStack[:last]
+}
+
+func redo(line *commandLine) {
+	if len(line.redoStack) == 0 {
+		return
+	}
+	last := len(line.redoStack) - 1
+	line.undoStack = append(line.undoStack, line.state())
+	line.restore(line.redoStack[last])
+	line.redoStack = line.redoStack[:last]
+}
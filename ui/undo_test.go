@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	defer withHistory("ls -la")()
+	state := defaultConsole.state
+	tc := func(input string, cursor int) []Candidate {
+		return []Candidate{{Text: "help", End: cursor}}
+	}
+
+	cases := []struct {
+		keys     string
+		expected string
+		cursor   int
+	}{
+		{"hello\x1f", "", 0},                                    // typing is one step
+		{"hello\x02\x02x\x1f", "hello", 3},                      // moving starts a new step
+		{"one two\x17\x1f", "one two", 7},                       // C-w
+		{"one two\x17\x01\x19\x1f", "one ", 0},                  // yank
+		{"one\x17\x1f\x1f", "", 0},                              // kill, then typing
+		{"abc\x18\x15", "", 0},                                  // C-x C-u
+		{"abc\x10", "ls -la", 6},                                // history recall...
+		{"abc\x10\x1f", "abc", 3},                               // ...can be undone
+		{"he\t\x1f", "he", 2},                                   // completion
+		{"hello\x1f\x1b\x1f", "hello", 5},                       // redo
+		{"hello\x1f\x1b\x1f\x1b\x1f", "hello", 5},               // nothing more to redo
+		{"hello\x1fa\x1b\x1f", "a", 1},                          // new edits clear redo
+		{"ab\x1f\x1f\x1f", "", 0},                               // nothing more to undo
+		{"x\x12ls\x06\x1f", "x", 1},                             // a search is one step
+		{"x\x12ls\x07\x1f", "", 0},                              // cancelled search
+		{"a" + PASTE_START + "bc" + PASTE_END + "\x1f", "a", 1}, // paste
+	}
+
+	for _, c := range cases {
+		state.killRing = state.killRing[:0]
+		state.history.index = len(state.history.commandHistory)
+		line := newLine()
+		typeKeys(&line, c.keys, tc)
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("undo %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+	}
+}
+
+func TestViUndo(t *testing.T) {
+	editMode = "vi"
+	defer func() { editMode = "emacs" }()
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys     string
+		expected string
+		cursor   int
+	}{
+		{"one two\x1bu", "", 0},
+		{"one two\x1bbdwu", "one two", 4},
+		{"one two\x1bbdwx2u", "one two", 4},
+		{"one two\x1bbdwu\x12", "one ", 3},
+	}
+
+	for _, c := range cases {
+		line := newLine()
+		typeKeys(&line, c.keys, tc)
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("vi undo %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+	vi editing mode. Lines start in insert state where keys behave as in the
+	default keymap. Esc switches to normal state, where keys are vi commands:
+
+		[count] motion
+		[count] operator [count] motion
+		[count] operator operator
+
+	Terminals send Alt + key as Esc followed by the key, so in insert state an
+	Alt key is taken as Esc and then the key in normal state. A lone Esc is
+	only seen once the escape timeout passes.
+*/
+
+const (
+	viMotions  = "hlwbe0$"
+	viCommands = "iaIAxXpPDCkju."
+)
+
+var (
+	editMode = "emacs"
+)
+
+// State of vi mode for a line
+//
+//	normal:    In normal state, otherwise insert state
+//	pending:   Keys of a normal state command typed so far
+//	recording: Change that is being recorded while inserting, nil if none
+type viState struct {
+	normal    bool
+	pending   string
+	recording *viChange
+}
+
+// A change that can be repeated: the normal state command that started it,
+// and the keys typed in insert state afterwards
+type viChange struct {
+	command  string
+	inserted []keyEvent
+}
+
+// A parsed normal state command
+type viCommand struct {
+	count    int
+	operator byte
+	motion   byte
+}
+
+func registerViOptions() {
+	RegisterOption("editmode", "Line editing mode, emacs or vi", editMode,
+		setEditMode)
+}
+
+func setEditMode(mode string) error {
+	if mode != "emacs" && mode != "vi" {
+		return errors.New(fmt.Sprintf("Unknown edit mode '%v', use emacs or vi", mode))
+	}
+	editMode = mode
+	return nil
+}
+
+// Prompt segment showing the vi state
+func (line *commandLine) viSegment() PromptSegment {
+	if line.vi.normal {
+		return NewStyledSegment("NORMAL", "normal")
+	}
+	return NewStyledSegment("INSERT", "insert")
+}
+
+// Leave insert state. Like vi, the cursor moves back onto the last character
+// inserted.
+func (line *commandLine) viEnterNormal() {
+	line.vi.normal = true
+	line.vi.pending = ""
+	if line.vi.recording != nil {
+		line.editor().viLastChange = *line.vi.recording
+		line.vi.recording = nil
+	}
+	if line.cursor > 0 {
+		line.cursor -= 1
+	}
+}
+
+func (line *commandLine) viEnterInsert() {
+	line.vi.normal = false
+}
+
+// Keep the cursor on a character, as normal state has no position past the
+// end of the line
+func (line *commandLine) viClampCursor() {
+	if line.cursor >= line.length() {
+		line.cursor = line.length() - 1
+	}
+	if line.cursor < 0 {
+		line.cursor = 0
+	}
+}
+
+// Handle a key in vi mode
+func (line *commandLine) handleViKey(event keyEvent) {
+	switch {
+	case line.vi.normal:
+		line.handleViNormalKey(event)
+	case event.key == "Esc":
+		line.viEnterNormal()
+	case event.mod&modAlt != 0:
+		// Esc followed by a key
+		line.viEnterNormal()
+		line.handleViNormalKey(event)
+	default:
+		if line.vi.recording != nil {
+			line.vi.recording.inserted = append(line.vi.recording.inserted, event)
+		}
+		line.handleEditKey(event)
+	}
+}
+
+// Handle a key in normal state. Special keys and control characters go to
+// the keymap.
+func (line *commandLine) handleViNormalKey(event keyEvent) {
+	// Esc does nothing in normal state, use the key that followed it
+	event.mod &^= modAlt
+
+	switch {
+	case event.key == "Esc":
+		line.vi.pending = ""
+		return
+	case event.isChar() && event.r < utf8.RuneSelf:
+		line.vi.pending += event.key
+		cmd, complete, valid := parseViCommand(line.vi.pending)
+		if !valid {
+			line.vi.pending = ""
+		} else if complete {
+			keys := line.vi.pending
+			line.vi.pending = ""
+			line.viExecute(cmd, keys)
+		}
+		return
+	case event.key == "Backspace":
+		backwardChar(line)
+	case event.String() == "C-r":
+		redo(line)
+		line.lastAction = "redo"
+	case event.key == "Paste":
+		line.paste(event.text)
+	default:
+		line.handleKey(event.String())
+	}
+	if line.vi.normal {
+		line.viClampCursor()
+	}
+}
+
+// Parse the keys of a normal state command. complete is false while more keys
+// are needed, valid is false when the keys can never form a command.
+func parseViCommand(keys string) (cmd viCommand, complete bool, valid bool) {
+	i := 0
+	count := func() int {
+		n := 0
+		for i < len(keys) && keys[i] >= '0' && keys[i] <= '9' && !(n == 0 && keys[i] == '0') {
+			n = n*10 + int(keys[i]-'0')
+			i++
+		}
+		if n == 0 {
+			return 1
+		}
+		return n
+	}
+
+	cmd.count = count()
+	if i == len(keys) {
+		return cmd, false, true
+	}
+	if strings.IndexByte("dcy", keys[i]) != -1 {
+		cmd.operator = keys[i]
+		i++
+		cmd.count *= count()
+		if i == len(keys) {
+			return cmd, false, true
+		}
+		if keys[i] != cmd.operator && strings.IndexByte(viMotions, keys[i]) == -1 {
+			return cmd, false, false
+		}
+	} else if strings.IndexByte(viMotions+viCommands, keys[i]) == -1 {
+		return cmd, false, false
+	}
+	cmd.motion = keys[i]
+	return cmd, i == len(keys)-1, i == len(keys)-1
+}
+
+func (line *commandLine) viExecute(cmd viCommand, keys string) {
+	runes := []rune(line.input)
+	// Kills in normal state are never joined
+	line.lastAction = ""
+
+	switch {
+	case cmd.motion == '.':
+		line.viRepeat(cmd.count)
+		return
+	case cmd.operator != 0:
+		line.viOperator(cmd)
+	case strings.IndexByte(viMotions, cmd.motion) != -1:
+		line.cursor = viMotion(runes, line.cursor, cmd.motion, cmd.count)
+	default:
+		line.viSimpleCommand(cmd)
+	}
+
+	if isViChange(cmd) {
+		change := viChange{keys, nil}
+		if line.vi.normal {
+			line.editor().viLastChange = change
+		} else {
+			line.vi.recording = &change
+		}
+	}
+	if line.vi.normal {
+		line.viClampCursor()
+	}
+}
+
+// Does the command change the line, so that '.' should repeat it
+func isViChange(cmd viCommand) bool {
+	if cmd.operator != 0 {
+		return cmd.operator != 'y'
+	}
+	return strings.IndexByte("iaIAxXpPDC", cmd.motion) != -1
+}
+
+// Run the last change again
+func (line *commandLine) viRepeat(count int) {
+	change := line.editor().viLastChange
+	if change.command == "" {
+		return
+	}
+	for i := 0; i < count; i++ {
+		for _, r := range change.command {
+			line.handleViNormalKey(keyEvent{key: string(r), r: r})
+		}
+		if line.vi.normal {
+			continue
+		}
+		for _, event := range change.inserted {
+			line.dispatchKeyEvent(event)
+		}
+		line.viEnterNormal()
+	}
+	line.editor().viLastChange = change
+}
+
+func (line *commandLine) viOperator(cmd viCommand) {
+	runes := []rune(line.input)
+	start, end := 0, len(runes)
+
+	// Doubled operators (dd, cc, yy) work on the whole line
+	if cmd.motion != cmd.operator {
+		motion := cmd.motion
+		start = line.cursor
+		if cmd.operator == 'c' && motion == 'w' && start < len(runes) &&
+			viClass(runes[start]) != 0 {
+			// Like vi, cw changes to the end of the word
+			motion = 'e'
+			end = viWordEnd(runes, start)
+			if cmd.count > 1 {
+				end = viMotion(runes, end, motion, cmd.count-1)
+			}
+		} else {
+			end = viMotion(runes, line.cursor, motion, cmd.count)
+		}
+		if end < start {
+			start, end = end, start
+		} else if motion == 'e' || motion == '$' {
+			end += 1 // inclusive motions
+		}
+		if end > len(runes) {
+			end = len(runes)
+		}
+	}
+
+	switch cmd.operator {
+	case 'y':
+		if start < end {
+			line.editor().pushKill(string(runes[start:end]))
+		}
+		line.cursor = start
+	case 'd':
+		line.kill(start, end)
+	case 'c':
+		line.kill(start, end)
+		line.viEnterInsert()
+	}
+}
+
+func (line *commandLine) viSimpleCommand(cmd viCommand) {
+	switch cmd.motion {
+	case 'i':
+		line.viEnterInsert()
+	case 'a':
+		if line.length() > 0 {
+			line.cursor += 1
+		}
+		line.viEnterInsert()
+	case 'I':
+		line.cursor = 0
+		line.viEnterInsert()
+	case 'A':
+		line.cursor = line.length()
+		line.viEnterInsert()
+	case 'x':
+		end := line.cursor + cmd.count
+		if end > line.length() {
+			end = line.length()
+		}
+		line.kill(line.cursor, end)
+	case 'X':
+		start := line.cursor - cmd.count
+		if start < 0 {
+			start = 0
+		}
+		line.kill(start, line.cursor)
+	case 'D':
+		line.kill(line.cursor, line.length())
+	case 'C':
+		line.kill(line.cursor, line.length())
+		line.viEnterInsert()
+	case 'p', 'P':
+		killRing := line.editor().killRing
+		if len(killRing) == 0 {
+			return
+		}
+		if cmd.motion == 'p' && line.length() > 0 {
+			line.cursor += 1
+		}
+		for i := 0; i < cmd.count; i++ {
+			line.insertYank(killRing[len(killRing)-1])
+		}
+		line.cursor -= 1
+	case 'k':
+		for i := 0; i < cmd.count; i++ {
+			previousHistory(line)
+		}
+		line.cursor = 0
+	case 'j':
+		for i := 0; i < cmd.count; i++ {
+			nextHistory(line)
+		}
+		line.cursor = 0
+	case 'u':
+		for i := 0; i < cmd.count; i++ {
+			undo(line)
+		}
+		line.lastAction = "undo"
+	}
+}
+
+// Character classes that separate vi words
+func viClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case r == '_' || isWordRune(r):
+		return 1
+	}
+	return 2
+}
+
+// Index of the last character of the word under the cursor
+func viWordEnd(runes []rune, cursor int) int {
+	class := viClass(runes[cursor])
+	for cursor < len(runes)-1 && viClass(runes[cursor+1]) == class {
+		cursor++
+	}
+	return cursor
+}
+
+// Position the cursor would move to. The result can be one past the last
+// character, so operators can reach the end of the line.
+func viMotion(runes []rune, cursor int, motion byte, count int) int {
+	for n := 0; n < count; n++ {
+		switch motion {
+		case 'h':
+			if cursor > 0 {
+				cursor--
+			}
+		case 'l':
+			if cursor < len(runes) {
+				cursor++
+			}
+		case 'w':
+			if cursor < len(runes) {
+				class := viClass(runes[cursor])
+				for cursor < len(runes) && class != 0 && viClass(runes[cursor]) == class {
+					cursor++
+				}
+			}
+			for cursor < len(runes) && viClass(runes[cursor]) == 0 {
+				cursor++
+			}
+		case 'b':
+			if cursor > 0 {
+				cursor--
+			}
+			for cursor > 0 && viClass(runes[cursor]) == 0 {
+				cursor--
+			}
+			if cursor < len(runes) {
+				class := viClass(runes[cursor])
+				for cursor > 0 && viClass(runes[cursor-1]) == class {
+					cursor--
+				}
+			}
+		case 'e':
+			if cursor < len(runes)-1 {
+				cursor++
+			}
+			for cursor < len(runes)-1 && viClass(runes[cursor]) == 0 {
+				cursor++
+			}
+			if cursor < len(runes) {
+				cursor = viWordEnd(runes, cursor)
+			}
+		case '0':
+			return 0
+		case '$':
+			if len(runes) == 0 {
+				return 0
+			}
+			return len(runes) - 1
+		}
+	}
+	return cursor
+}
@@ -0,0 +1,126 @@
+package ui
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestViMode(t *testing.T) {
+	editMode = "vi"
+	defer func() { editMode = "emacs" }()
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys     string
+		expected string
+		cursor   int
+		normal   bool
+	}{
+		{"hello", "hello", 5, false},
+		{"hello\x1b", "hello", 4, true},
+		{"hello\x1b0", "hello", 0, true},
+		{"hello\x1b0$", "hello", 4, true},
+		{"hello\x1bhh", "hello", 2, true},
+		{"hello\x1b3h", "hello", 1, true},
+		{"hello\x1b0lll", "hello", 3, true},
+		{"hello\x1b0llllllll", "hello", 4, true},
+		{"one two three\x1b0w", "one two three", 4, true},
+		{"one two three\x1b0ww", "one two three", 8, true},
+		{"one two three\x1b02w", "one two three", 8, true},
+		{"one two three\x1bb", "one two three", 8, true},
+		{"one two three\x1b0e", "one two three", 2, true},
+		{"one.two three\x1b0w", "one.two three", 3, true},
+		{"one two three\x1b0dw", "two three", 0, true},
+		{"one two three\x1b0d2w", "three", 0, true},
+		{"one two three\x1b02dw", "three", 0, true},
+		{"one two three\x1b0de", " two three", 0, true},
+		{"one two three\x1b0wd$", "one ", 3, true},
+		{"one two three\x1bd0", "e", 0, true},
+		{"one two three\x1bdd", "", 0, true},
+		{"one two three\x1b0cwuno\x1b", "uno two three", 2, true},
+		{"one two three\x1bccnew", "new", 3, false},
+		{"one two three\x1b0wD", "one ", 3, true},
+		{"one two three\x1b0wCfour", "one four", 8, false},
+		{"hello\x1b0x", "ello", 0, true},
+		{"hello\x1b03x", "lo", 0, true},
+		{"hello\x1bX", "helo", 3, true},
+		{"hello\x1b0ywP", "hellohello", 4, true},
+		{"hello\x1b0xp", "ehllo", 1, true},
+		{"hello\x1b0yy$p", "hellohello", 9, true},
+		{"ab\x1b0iX\x1b", "Xab", 0, true},
+		{"ab\x1baX\x1b", "abX", 2, true},
+		{"ab\x1b0AX\x1b", "abX", 2, true},
+		{"ab\x1bIX\x1b", "Xab", 0, true},
+		{"one two three\x1b0dw.", "three", 0, true},
+		{"abcdef\x1b0x..", "def", 0, true},
+		{"abcdef\x1b0x3.", "ef", 0, true},
+		{"a b c\x1b0cwX\x1bw.", "X X c", 2, true},
+		{"one two\x1b0iX\x1bw.", "Xone Xtwo", 5, true},
+		{"hello\x1bq", "hello", 4, true}, // unknown commands are ignored
+		{"hello\x1bdq", "hello", 4, true},
+		{"hello\x1bhi\x7f", "helo", 2, false},
+	}
+
+	for _, c := range cases {
+		defaultConsole.state.killRing = defaultConsole.state.killRing[:0]
+		defaultConsole.state.viLastChange = viChange{}
+		line := newLine()
+		typeKeys(&line, c.keys, tc)
+		if line.input != c.expected || line.cursor != c.cursor {
+			t.Errorf("vi %q = %q at %v, want %q at %v",
+				c.keys, line.input, line.cursor, c.expected, c.cursor)
+		}
+		if line.vi.normal != c.normal {
+			t.Errorf("vi %q normal = %v, want %v", c.keys, line.vi.normal, c.normal)
+		}
+	}
+}
+
+// '.' repeats the last change made on the same console
+func TestViRepeatPerConsole(t *testing.T) {
+	editMode = "vi"
+	defer func() { editMode = "emacs" }()
+	tc := NilTabComplete
+	first := NewConsole(nil, &bytes.Buffer{}, nil)
+	second := NewConsole(nil, &bytes.Buffer{}, nil)
+
+	line := first.newLine()
+	typeKeys(&line, "abc\x1bx", tc)
+	line = second.newLine()
+	typeKeys(&line, "abc\x1b.", tc)
+	if line.input != "abc" {
+		t.Errorf("'.' on another console changed the line to %q", line.input)
+	}
+	line = first.newLine()
+	typeKeys(&line, "abc\x1b.", tc)
+	if line.input != "ab" {
+		t.Errorf("'.' on the same console gave %q, want %q", line.input, "ab")
+	}
+}
+
+func TestViHistory(t *testing.T) {
+	editMode = "vi"
+	defer func() { editMode = "emacs" }()
+	defer withHistory("first", "second", "third")()
+	tc := NilTabComplete
+
+	cases := []struct {
+		keys     string
+		expected string
+	}{
+		{"\x1b\x1bk", "third"},
+		{"k", "second"},
+		{"2k", "first"},
+		{"j", "second"},
+	}
+
+	line := newLine()
+	for _, c := range cases {
+		for i := 0; i < len(c.keys); i++ {
+			line.handleInput(c.keys[i], tc)
+		}
+		if line.input != c.expected {
+			t.Errorf("vi history %q = %q, want %q", c.keys, line.input, c.expected)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+)
+
+/*
+	Splitting input into words the way a shell does. Whitespace inside single
+	or double quotes, or after a backslash, does not end a word, and the
+	quotes and backslashes are removed from the words.
+
+	Several commands can be given on one line separated by semicolons, which
+	likewise only count outside quotes.
+*/
+
+const (
+	// Characters that quoteWord puts a backslash in front of. ~ is left
+	// alone so it still means the home directory.
+	specialChars = " \t\n'\"\\$&;|<>()*?`#!"
+)
+
+// Split input into unquoted words
+func splitWords(input string) []string {
+	runes := []rune(input)
+	words := make([]string, 0, 8)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		end := shellWordEnd(runes, i)
+		words = append(words, unquoteWord(string(runes[i:end])))
+		i = end
+	}
+	return words
+}
+
+// Split input into commands at semicolons and newlines that are not quoted
+// or escaped. Empty commands and comments, starting with #, are left out.
+func SplitCommands(input string) []string {
+	runes := []rune(input)
+	commands := make([]string, 0, 4)
+	add := func(command string) {
+		command = strings.TrimSpace(command)
+		if command != "" && command[0] != '#' {
+			commands = append(commands, command)
+		}
+	}
+
+	start := 0
+	var quote rune
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if runes[i] == quote {
+				quote = 0
+			}
+		case runes[i] == '\'' || runes[i] == '"':
+			quote = runes[i]
+		case runes[i] == ';' || runes[i] == '\n':
+			add(string(runes[start:i]))
+			start = i + 1
+		}
+	}
+	if start < len(runes) {
+		add(string(runes[start:]))
+	}
+	return commands
+}
+
+// Index just past the word starting at start
+func shellWordEnd(runes []rune, start int) int {
+	var quote rune
+	i := start
+	for ; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && quote != '\'':
+			i++ // skip the escaped rune
+		case quote != 0:
+			if runes[i] == quote {
+				quote = 0
+			}
+		case runes[i] == '\'' || runes[i] == '"':
+			quote = runes[i]
+		case unicode.IsSpace(runes[i]):
+			return i
+		}
+	}
+	if i > len(runes) {
+		return len(runes)
+	}
+	return i
+}
+
+// Index of the start of the word that ends at end, end itself if the rune
+// before it ends a word
+func shellWordStart(runes []rune, end int) int {
+	start := 0
+	for start < end {
+		for start < end && unicode.IsSpace(runes[start]) {
+			start++
+		}
+		next := shellWordEnd(runes[:end], start)
+		if next >= end {
+			break
+		}
+		start = next
+	}
+	return start
+}
+
+// Remove the quotes and backslashes from a word. Unterminated quotes are
+// taken to run to the end of the word.
+func unquoteWord(word string) string {
+	unquoted := make([]rune, 0, len(word))
+	var quote rune
+	runes := []rune(word)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && quote != '\'' && i+1 < len(runes):
+			i++
+			if quote == '"' && !strings.ContainsRune("\"\\$`", runes[i]) {
+				// Only a few characters can be escaped in double quotes
+				unquoted = append(unquoted, r)
+			}
+			unquoted = append(unquoted, runes[i])
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		default:
+			unquoted = append(unquoted, r)
+		}
+	}
+	return string(unquoted)
+}
+
+// Escape the characters of a word that a shell would treat specially
+func quoteWord(word string) string {
+	quoted := make([]rune, 0, len(word))
+	for _, r := range word {
+		if strings.ContainsRune(specialChars, r) {
+			quoted = append(quoted, '\\')
+		}
+		quoted = append(quoted, r)
+	}
+	return string(quoted)
+}
@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{"", []string{}},
+		{"  ls  -la ", []string{"ls", "-la"}},
+		{`cat My\ File.txt`, []string{"cat", "My File.txt"}},
+		{`echo 'a  b' "c d" e\"f`, []string{"echo", "a  b", "c d", `e"f`}},
+		{`echo "a\"b\n" 'c\d'`, []string{"echo", `a"b\n`, `c\d`}},
+		{`echo "unterminated  quote`, []string{"echo", "unterminated  quote"}},
+		{`echo x"y z"w`, []string{"echo", "xy zw"}},
+	}
+
+	for _, c := range cases {
+		got := splitWords(c.input)
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("splitWords(%q) = %q, want %q", c.input, got, c.expected)
+		}
+	}
+}
+
+func TestQuoteWord(t *testing.T) {
+	cases := []struct {
+		word   string
+		quoted string
+	}{
+		{"plain", "plain"},
+		{"My File.txt", `My\ File.txt`},
+		{`a'b"c\d$e`, `a\'b\"c\\d\$e`},
+		{"~/dir (1)", `~/dir\ \(1\)`},
+	}
+
+	for _, c := range cases {
+		got := quoteWord(c.word)
+		if got != c.quoted {
+			t.Errorf("quoteWord(%q) = %q, want %q", c.word, got, c.quoted)
+		}
+		if unquoted := unquoteWord(got); unquoted != c.word {
+			t.Errorf("unquoteWord(%q) = %q, want %q", got, unquoted, c.word)
+		}
+	}
+}
+
+func TestShellWordStart(t *testing.T) {
+	cases := []struct {
+		input string
+		end   int
+		start int
+	}{
+		{"", 0, 0},
+		{"cat", 3, 0},
+		{"cat ", 4, 4},
+		{"cat /etc/pas", 12, 4},
+		{`cat My\ Fi`, 10, 4},
+		{`cat "My Fi`, 10, 4},
+		{`cat 'a b' c`, 11, 10},
+		{"cat abc def", 6, 4},
+	}
+
+	for _, c := range cases {
+		got := shellWordStart([]rune(c.input), c.end)
+		if got != c.start {
+			t.Errorf("shellWordStart(%q, %v) = %v, want %v", c.input, c.end, got, c.start)
+		}
+	}
+}
+
+func TestSplitCommands(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []string
+	}{
+		{"", []string{}},
+		{" ; ;", []string{}},
+		{"help", []string{"help"}},
+		{"set a 1; set b 2;help", []string{"set a 1", "set b 2", "help"}},
+		{"ls\n  pwd  \n\n", []string{"ls", "pwd"}},
+		{`echo 'a;b' "c;d" e\;f; ls`, []string{`echo 'a;b' "c;d" e\;f`, "ls"}},
+		{"# a comment\nls # not a comment", []string{"ls # not a comment"}},
+		{"ls; # comment; pwd", []string{"ls", "pwd"}},
+		{"echo 'a\nb'", []string{"echo 'a\nb'"}},
+	}
+
+	for _, c := range cases {
+		got := SplitCommands(c.input)
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("SplitCommands(%q) = %q, want %q", c.input, got, c.expected)
+		}
+	}
+}